@@ -54,3 +54,22 @@ func ReadGobToMap(r io.Reader) (map[string]interface{}, error) {
   }
   return GobToMap(data)
 }
+
+func ToGob(any interface{}) ([]byte, error) {
+  if any == nil {
+    return nil, base.ErrInvalidArgument
+  }
+  var buf bytes.Buffer
+  e := gob.NewEncoder(&buf).Encode(any)
+  if e != nil {
+    return nil, e
+  }
+  return buf.Bytes(), nil
+}
+
+func FromGob(data []byte, out interface{}) error {
+  if len(data) == 0 || out == nil {
+    return base.ErrInvalidArgument
+  }
+  return gob.NewDecoder(bytes.NewBuffer(data)).Decode(out)
+}
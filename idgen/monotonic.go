@@ -0,0 +1,73 @@
+package idgen
+
+import (
+  cr "crypto/rand"
+  "io"
+  "sync"
+  "time"
+
+  "github.com/kwf2030/commons/conv"
+  "github.com/kwf2030/commons/time2"
+)
+
+// ULID和UUIDv7共用的单调生成器，值由48位毫秒时间戳和随机数组成，
+// 随机数分为高hiBits位和低loBits位，
+// 同一毫秒（或时钟回拨）时在上一个随机数上加1，而不是重新生成，保证严格递增，
+// 随机数溢出时借用下一毫秒的时间戳
+type monotonic struct {
+  clock time2.Clock
+
+  entropy io.Reader
+
+  hiBits, loBits uint
+
+  mu sync.Mutex
+
+  // Unix毫秒
+  ms uint64
+
+  hi, lo uint64
+}
+
+func newMonotonic(clock time2.Clock, hiBits, loBits uint) *monotonic {
+  if clock == nil {
+    clock = time2.RealClock
+  }
+  return &monotonic{clock: clock, entropy: cr.Reader, hiBits: hiBits, loBits: loBits}
+}
+
+func (m *monotonic) next() (uint64, uint64, uint64, error) {
+  m.mu.Lock()
+  defer m.mu.Unlock()
+  ms := uint64(m.clock.Now().UnixNano() / int64(time.Millisecond))
+  if ms > m.ms {
+    if e := m.random(); e != nil {
+      return 0, 0, 0, e
+    }
+    m.ms = ms
+  } else if m.lo++; m.lo == 1<<m.loBits {
+    // loBits为64时1<<m.loBits为0，正好是溢出后的值
+    m.lo = 0
+    if m.hi++; m.hi == 1<<m.hiBits {
+      if e := m.random(); e != nil {
+        return 0, 0, 0, e
+      }
+      m.ms++
+    }
+  }
+  if m.ms >= 1<<48 {
+    return 0, 0, 0, ErrTimestampOverflow
+  }
+  return m.ms, m.hi, m.lo, nil
+}
+
+func (m *monotonic) random() error {
+  b := make([]byte, 16)
+  if _, e := io.ReadFull(m.entropy, b); e != nil {
+    return e
+  }
+  m.hi = conv.BytesToUint64(b[:8]) & (1<<m.hiBits - 1)
+  // 最高位置0，减少同一毫秒内溢出的可能
+  m.lo = conv.BytesToUint64(b[8:]) & (1<<(m.loBits-1) - 1)
+  return nil
+}
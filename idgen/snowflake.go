@@ -0,0 +1,178 @@
+package idgen
+
+import (
+  "errors"
+  "strconv"
+  "sync"
+  "time"
+
+  "github.com/kwf2030/commons/base"
+  "github.com/kwf2030/commons/conv"
+  "github.com/kwf2030/commons/time2"
+)
+
+var (
+  // 时钟回拨超过了允许的范围（见WithMaxBackwards）
+  ErrClockBackwards = errors.New("idgen: clock moved backwards")
+
+  // 时间戳超出了可以表示的范围（epoch之前或太久之后）
+  ErrTimestampOverflow = errors.New("idgen: timestamp overflow")
+)
+
+// 默认的epoch，2020-01-01 00:00:00 UTC
+var DefaultEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type SnowflakeOption func(*Snowflake)
+
+func WithEpoch(epoch time.Time) SnowflakeOption {
+  return func(s *Snowflake) {
+    s.epoch = epoch
+  }
+}
+
+// worker ID和序列号的位数，默认为10和12（1024个worker，每个worker每毫秒4096个ID），
+// 剩下的63-workerBits-seqBits位为毫秒时间戳（默认41位，约69年）
+func WithBits(workerBits, seqBits uint) SnowflakeOption {
+  return func(s *Snowflake) {
+    s.workerBits = workerBits
+    s.seqBits = seqBits
+  }
+}
+
+func WithClock(c time2.Clock) SnowflakeOption {
+  return func(s *Snowflake) {
+    s.clock = c
+  }
+}
+
+// 允许的最大时钟回拨，默认为10毫秒，
+// 回拨不超过d时继续使用上一次的时间戳（序列号用完时等待时钟追上），超过时Next返回ErrClockBackwards
+func WithMaxBackwards(d time.Duration) SnowflakeOption {
+  return func(s *Snowflake) {
+    s.maxBackwards = int64(d / time.Millisecond)
+  }
+}
+
+// Snowflake ID生成器，ID由时间戳、worker ID和序列号组成，
+// 同一个生成器生成的ID严格递增，可以并发调用
+type Snowflake struct {
+  clock time2.Clock
+
+  epoch time.Time
+
+  workerBits, seqBits uint
+
+  workerID int64
+
+  // 毫秒
+  maxBackwards int64
+
+  mu sync.Mutex
+
+  // 上一个ID的时间戳（相对于epoch的毫秒数）
+  last int64
+
+  seq int64
+}
+
+func NewSnowflake(workerID int64, opts ...SnowflakeOption) (*Snowflake, error) {
+  s := &Snowflake{
+    clock:        time2.RealClock,
+    epoch:        DefaultEpoch,
+    workerBits:   10,
+    seqBits:      12,
+    workerID:     workerID,
+    maxBackwards: 10,
+    last:         -1,
+  }
+  for _, opt := range opts {
+    opt(s)
+  }
+  if s.clock == nil || s.workerBits+s.seqBits > 22 || s.seqBits == 0 ||
+    workerID < 0 || workerID >= 1<<s.workerBits || s.maxBackwards < 0 {
+    return nil, base.ErrInvalidArgument
+  }
+  return s, nil
+}
+
+func (s *Snowflake) Next() (SnowflakeID, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  ts := s.since()
+  if ts < s.last {
+    if s.last-ts > s.maxBackwards {
+      return 0, ErrClockBackwards
+    }
+    ts = s.last
+  }
+  if ts == s.last {
+    s.seq = (s.seq + 1) & (1<<s.seqBits - 1)
+    if s.seq == 0 {
+      // 这一毫秒的序列号用完了，等到下一毫秒
+      for ts <= s.last {
+        s.clock.Sleep(time.Millisecond)
+        ts = s.since()
+      }
+    }
+  } else {
+    s.seq = 0
+  }
+  if ts < 0 || ts >= 1<<(63-s.workerBits-s.seqBits) {
+    return 0, ErrTimestampOverflow
+  }
+  s.last = ts
+  return SnowflakeID(ts<<(s.workerBits+s.seqBits) | s.workerID<<s.seqBits | s.seq), nil
+}
+
+func (s *Snowflake) since() int64 {
+  return int64(s.clock.Now().Sub(s.epoch) / time.Millisecond)
+}
+
+// 把id拆分为时间、worker ID和序列号，id需要是相同配置的生成器生成的
+func (s *Snowflake) Parse(id SnowflakeID) (time.Time, int64, int64) {
+  ts := int64(id) >> (s.workerBits + s.seqBits)
+  worker := int64(id) >> s.seqBits & (1<<s.workerBits - 1)
+  seq := int64(id) & (1<<s.seqBits - 1)
+  return s.epoch.Add(time.Duration(ts) * time.Millisecond), worker, seq
+}
+
+type SnowflakeID int64
+
+// 十进制字符串
+func (id SnowflakeID) String() string {
+  return strconv.FormatInt(int64(id), 10)
+}
+
+// 8字节大端序，字节序与数值顺序一致
+func (id SnowflakeID) Bytes() []byte {
+  return conv.Uint64ToBytes(uint64(id))
+}
+
+// 序列化为十进制字符串（JSON中为字符串，避免JavaScript丢失精度）
+func (id SnowflakeID) MarshalText() ([]byte, error) {
+  return []byte(id.String()), nil
+}
+
+func (id *SnowflakeID) UnmarshalText(data []byte) error {
+  v, e := ParseSnowflakeID(string(data))
+  if e != nil {
+    return e
+  }
+  *id = v
+  return nil
+}
+
+func ParseSnowflakeID(s string) (SnowflakeID, error) {
+  v, e := strconv.ParseInt(s, 10, 64)
+  if e != nil || v < 0 {
+    return 0, base.ErrInvalidArgument
+  }
+  return SnowflakeID(v), nil
+}
+
+func SnowflakeIDFromBytes(data []byte) (SnowflakeID, error) {
+  if len(data) != 8 || data[0]&0x80 != 0 {
+    return 0, base.ErrInvalidArgument
+  }
+  return SnowflakeID(conv.BytesToUint64(data)), nil
+}
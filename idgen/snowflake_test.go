@@ -0,0 +1,92 @@
+package idgen
+
+import (
+  "encoding/json"
+  "sync"
+  "testing"
+  "time"
+
+  "github.com/kwf2030/commons/time2"
+)
+
+func TestSnowflake(t *testing.T) {
+  c := time2.NewFakeClock(DefaultEpoch.Add(time.Hour))
+  s, e := NewSnowflake(5, WithClock(c), WithBits(10, 1))
+  if e != nil {
+    t.Fatal(e)
+  }
+  id1, _ := s.Next()
+  id2, _ := s.Next()
+  if ts, worker, seq := s.Parse(id2); !ts.Equal(c.Now()) || worker != 5 || seq != 1 || id2 <= id1 {
+    t.Errorf("got %d, %d: %v, %d, %d", id1, id2, ts, worker, seq)
+  }
+
+  // 序列号用完时等待下一毫秒
+  ch := make(chan SnowflakeID)
+  go func() {
+    id, _ := s.Next()
+    ch <- id
+  }()
+  var id3 SnowflakeID
+  for id3 == 0 {
+    c.Advance(time.Millisecond)
+    select {
+    case id3 = <-ch:
+    case <-time.After(time.Millisecond * 10):
+    }
+  }
+  if id3 <= id2 {
+    t.Errorf("got %d", id3)
+  }
+
+  // 允许范围内的回拨继续使用上一次的时间戳
+  c.Set(c.Now().Add(-time.Millisecond * 5))
+  if id4, e := s.Next(); e != nil || id4 <= id3 {
+    t.Errorf("got %d, %v", id4, e)
+  }
+  c.Set(c.Now().Add(-time.Second))
+  if _, e := s.Next(); e != ErrClockBackwards {
+    t.Errorf("got %v", e)
+  }
+
+  if _, e := NewSnowflake(1024); e == nil {
+    t.Error("expected error")
+  }
+  data, _ := json.Marshal(id3)
+  var v SnowflakeID
+  if e := json.Unmarshal(data, &v); e != nil || v != id3 || string(data) != `"`+id3.String()+`"` {
+    t.Errorf("got %s, %d, %v", data, v, e)
+  }
+  if v, e := SnowflakeIDFromBytes(id3.Bytes()); e != nil || v != id3 {
+    t.Errorf("got %d, %v", v, e)
+  }
+}
+
+func TestSnowflakeConcurrent(t *testing.T) {
+  s, _ := NewSnowflake(1)
+  var mu sync.Mutex
+  seen := make(map[SnowflakeID]bool)
+  var wg sync.WaitGroup
+  for i := 0; i < 8; i++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      var last SnowflakeID
+      for j := 0; j < 5000; j++ {
+        id, e := s.Next()
+        if e != nil || id <= last {
+          t.Errorf("got %d after %d, %v", id, last, e)
+          return
+        }
+        last = id
+        mu.Lock()
+        seen[id] = true
+        mu.Unlock()
+      }
+    }()
+  }
+  wg.Wait()
+  if len(seen) != 40000 {
+    t.Errorf("got %d unique ids", len(seen))
+  }
+}
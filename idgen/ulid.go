@@ -0,0 +1,125 @@
+package idgen
+
+import (
+  "time"
+
+  "github.com/kwf2030/commons/base"
+  "github.com/kwf2030/commons/conv"
+  "github.com/kwf2030/commons/time2"
+)
+
+// Crockford's Base32，去掉了I、L、O、U
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var crockfordDec [256]byte
+
+func init() {
+  for i := range crockfordDec {
+    crockfordDec[i] = 0xff
+  }
+  for i := 0; i < len(crockford); i++ {
+    crockfordDec[crockford[i]] = byte(i)
+    crockfordDec[crockford[i]|0x20] = byte(i)
+  }
+  for _, c := range "Oo" {
+    crockfordDec[c] = 0
+  }
+  for _, c := range "IiLl" {
+    crockfordDec[c] = 1
+  }
+}
+
+// 16字节，前6字节为Unix毫秒时间戳（大端序），后10字节为随机数，
+// 字符串为26个字符的Crockford's Base32，字节序和字符串的顺序都与生成顺序一致
+type ULID [16]byte
+
+// ULID生成器，同一个生成器生成的ULID严格递增，可以并发调用
+type ULIDGenerator struct {
+  m *monotonic
+}
+
+// clock为nil时为RealClock
+func NewULIDGenerator(clock time2.Clock) *ULIDGenerator {
+  return &ULIDGenerator{m: newMonotonic(clock, 16, 64)}
+}
+
+func (g *ULIDGenerator) Next() (ULID, error) {
+  ms, hi, lo, e := g.m.next()
+  if e != nil {
+    return ULID{}, e
+  }
+  var u ULID
+  copy(u[:8], conv.Uint64ToBytes(ms<<16|hi))
+  copy(u[8:], conv.Uint64ToBytes(lo))
+  return u, nil
+}
+
+var defaultULID = NewULIDGenerator(nil)
+
+// 使用默认的生成器生成ULID
+func NewULID() (ULID, error) {
+  return defaultULID.Next()
+}
+
+func (u ULID) Time() time.Time {
+  ms := int64(conv.BytesToUint64(u[:8]) >> 16)
+  return time.Unix(ms/1000, ms%1000*int64(time.Millisecond))
+}
+
+func (u ULID) Bytes() []byte {
+  return u[:]
+}
+
+func (u ULID) String() string {
+  hi, lo := conv.BytesToUint64(u[:8]), conv.BytesToUint64(u[8:])
+  b := make([]byte, 26)
+  for i := 25; i >= 0; i-- {
+    b[i] = crockford[lo&31]
+    lo = lo>>5 | hi<<59
+    hi >>= 5
+  }
+  return string(b)
+}
+
+func (u ULID) MarshalText() ([]byte, error) {
+  return []byte(u.String()), nil
+}
+
+func (u *ULID) UnmarshalText(data []byte) error {
+  v, e := ParseULID(string(data))
+  if e != nil {
+    return e
+  }
+  *u = v
+  return nil
+}
+
+// 解析ULID字符串，不区分大小写，按Crockford's Base32的规则I/L视为1、O视为0
+func ParseULID(s string) (ULID, error) {
+  // 26个字符共130位，第一个字符只能是0~7
+  if len(s) != 26 || crockfordDec[s[0]] > 7 {
+    return ULID{}, base.ErrInvalidArgument
+  }
+  var hi, lo uint64
+  for i := 0; i < len(s); i++ {
+    c := crockfordDec[s[i]]
+    if c == 0xff {
+      return ULID{}, base.ErrInvalidArgument
+    }
+    hi = hi<<5 | lo>>59
+    lo = lo<<5 | uint64(c)
+  }
+  var u ULID
+  copy(u[:8], conv.Uint64ToBytes(hi))
+  copy(u[8:], conv.Uint64ToBytes(lo))
+  return u, nil
+}
+
+func ULIDFromBytes(data []byte) (ULID, error) {
+  var u ULID
+  if len(data) != len(u) {
+    return u, base.ErrInvalidArgument
+  }
+  copy(u[:], data)
+  return u, nil
+}
@@ -0,0 +1,43 @@
+package idgen
+
+import (
+  "bytes"
+  "testing"
+  "time"
+
+  "github.com/kwf2030/commons/time2"
+)
+
+func TestULID(t *testing.T) {
+  now := time.Date(2020, 8, 13, 15, 4, 5, 123000000, time.UTC)
+  c := time2.NewFakeClock(now)
+  g := NewULIDGenerator(c)
+  prev, _ := g.Next()
+  for i := 0; i < 1000; i++ {
+    if i == 500 {
+      c.Set(now.Add(-time.Second))
+    }
+    u, e := g.Next()
+    if e != nil || bytes.Compare(u[:], prev[:]) <= 0 || u.String() <= prev.String() {
+      t.Fatalf("got %s after %s, %v", u, prev, e)
+    }
+    prev = u
+  }
+  if !prev.Time().Equal(now) {
+    t.Errorf("got %v", prev.Time())
+  }
+
+  // 规范中的例子
+  u, e := ParseULID("01ARZ3NDEKTSV4RRFFQ69G5FAV")
+  if e != nil || u.String() != "01ARZ3NDEKTSV4RRFFQ69G5FAV" || u.Time().UnixNano()/int64(time.Millisecond) != 1469922850259 {
+    t.Errorf("got %s, %v", u, e)
+  }
+  if v, e := ParseULID("01arz3ndektsv4rrffq69g5fav"); e != nil || v != u {
+    t.Errorf("got %s, %v", v, e)
+  }
+  for _, s := range []string{"81ARZ3NDEKTSV4RRFFQ69G5FAV", "01ARZ3NDEKTSV4RRFFQ69G5FA", "01ARZ3NDEKTSV4RRFFQ69G5FAU"} {
+    if _, e := ParseULID(s); e == nil {
+      t.Errorf("%s: expected error", s)
+    }
+  }
+}
@@ -0,0 +1,36 @@
+package idgen
+
+import (
+  "bytes"
+  "testing"
+  "time"
+
+  "github.com/kwf2030/commons/time2"
+)
+
+func TestUUIDv7(t *testing.T) {
+  now := time.Date(2020, 8, 13, 15, 4, 5, 123000000, time.UTC)
+  g := NewUUIDv7Generator(time2.NewFakeClock(now))
+  var prev UUID
+  for i := 0; i < 1000; i++ {
+    u, e := g.Next()
+    if e != nil || bytes.Compare(u[:], prev[:]) <= 0 || u.String() <= prev.String() {
+      t.Fatalf("got %s after %s, %v", u, prev, e)
+    }
+    prev = u
+  }
+  if prev.Version() != 7 || prev[8]>>6 != 2 || !prev.Time().Equal(now) {
+    t.Errorf("got %s, %v", prev, prev.Time())
+  }
+
+  u, e := ParseUUID("017f22e2-79b0-7cc3-98c4-dc0c0c07398f")
+  if e != nil || u.String() != "017f22e2-79b0-7cc3-98c4-dc0c0c07398f" || u.Time().UnixNano()/int64(time.Millisecond) != 0x017f22e279b0 {
+    t.Errorf("got %s, %v", u, e)
+  }
+  if v, e := ParseUUID("017F22E279B07CC398C4DC0C0C07398F"); e != nil || v != u {
+    t.Errorf("got %s, %v", v, e)
+  }
+  if _, e := ParseUUID("017f22e2-79b0-7cc3-98c4_dc0c0c07398f"); e == nil {
+    t.Error("expected error")
+  }
+}
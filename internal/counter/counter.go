@@ -0,0 +1,41 @@
+package counter
+
+import (
+  "sync"
+)
+
+// 可等待归零的计数器，
+// 与sync.WaitGroup不同，计数器为0时Wait和Inc可以同时调用
+type Counter struct {
+  n int
+
+  cond *sync.Cond
+}
+
+func New() Counter {
+  return Counter{cond: sync.NewCond(&sync.Mutex{})}
+}
+
+func (c *Counter) Inc() {
+  c.cond.L.Lock()
+  c.n++
+  c.cond.L.Unlock()
+}
+
+func (c *Counter) Dec() {
+  c.cond.L.Lock()
+  c.n--
+  if c.n == 0 {
+    c.cond.Broadcast()
+  }
+  c.cond.L.Unlock()
+}
+
+// 阻塞直到计数器为0
+func (c *Counter) Wait() {
+  c.cond.L.Lock()
+  for c.n > 0 {
+    c.cond.Wait()
+  }
+  c.cond.L.Unlock()
+}
@@ -0,0 +1,122 @@
+package pipeline
+
+import (
+  "hash/fnv"
+  "sync"
+  "sync/atomic"
+)
+
+const (
+  // 队列满时阻塞调用方（背压），直到有空位
+  Block = iota
+  // 队列满时丢弃
+  Drop
+)
+
+// 异步执行Handler的goroutine池，通过Pipeline.Bind绑定到HandlerContext，
+// 每个worker有自己的队列，key相同的数据总是由同一个worker按提交顺序处理，
+// key为nil时（以及FireError传递的错误）轮流分配给各个worker（只有一个worker时所有数据按顺序处理）
+type Executor struct {
+  // 64位原子操作的字段放在最前面，保证32位平台上的对齐
+  dropped uint64
+
+  next uint32
+
+  queues []chan func()
+
+  policy int
+
+  key func(interface{}) string
+
+  workers sync.WaitGroup
+
+  closed bool
+
+  mu sync.RWMutex
+}
+
+// workers为worker数量，bufferSize为每个worker的队列长度，
+// policy为队列满时的处理方式（Block/Drop），key为数据的分组函数（可以为nil）
+func NewExecutor(workers, bufferSize, policy int, key func(interface{}) string) *Executor {
+  if workers <= 0 || bufferSize < 0 {
+    return nil
+  }
+  e := &Executor{
+    queues: make([]chan func(), workers),
+    policy: policy,
+    key:    key,
+    mu:     sync.RWMutex{},
+  }
+  e.workers.Add(workers)
+  for i := range e.queues {
+    e.queues[i] = make(chan func(), bufferSize)
+    go e.work(e.queues[i])
+  }
+  return e
+}
+
+// 提交data的处理函数f，被丢弃（队列满或已Close）时返回false
+func (e *Executor) execute(data interface{}, f func()) bool {
+  e.mu.RLock()
+  defer e.mu.RUnlock()
+  if e.closed {
+    atomic.AddUint64(&e.dropped, 1)
+    return false
+  }
+  var i int
+  if _, ok := data.(errorData); !ok && e.key != nil {
+    h := fnv.New32a()
+    h.Write([]byte(e.key(data)))
+    i = int(h.Sum32() % uint32(len(e.queues)))
+  } else {
+    i = int((atomic.AddUint32(&e.next, 1) - 1) % uint32(len(e.queues)))
+  }
+  if e.policy == Drop {
+    select {
+    case e.queues[i] <- f:
+      return true
+    default:
+      atomic.AddUint64(&e.dropped, 1)
+      return false
+    }
+  }
+  e.queues[i] <- f
+  return true
+}
+
+// 累计丢弃的数据数量
+func (e *Executor) Dropped() uint64 {
+  return atomic.LoadUint64(&e.dropped)
+}
+
+// 正在排队的数据数量
+func (e *Executor) Queued() int {
+  n := 0
+  for _, q := range e.queues {
+    n += len(q)
+  }
+  return n
+}
+
+// 不再接受新的数据，等待队列中的数据全部处理完后退出所有worker，
+// 之后提交的数据都会被丢弃
+func (e *Executor) Close() {
+  e.mu.Lock()
+  if e.closed {
+    e.mu.Unlock()
+    return
+  }
+  e.closed = true
+  for _, q := range e.queues {
+    close(q)
+  }
+  e.mu.Unlock()
+  e.workers.Wait()
+}
+
+func (e *Executor) work(q chan func()) {
+  defer e.workers.Done()
+  for f := range q {
+    f()
+  }
+}
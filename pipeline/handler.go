@@ -1,11 +1,19 @@
 package pipeline
 
+import (
+  "fmt"
+  "runtime/debug"
+)
+
 type HandlerContext struct {
   prev     *HandlerContext
   next     *HandlerContext
   pipeline *Pipeline
   name     string
   handler  Handler
+
+  // 不为nil时异步执行handler
+  executor *Executor
 }
 
 func (ctx *HandlerContext) Prev() *HandlerContext {
@@ -45,16 +53,135 @@ func (ctx *HandlerContext) Fire(data interface{}) {
   next := ctx.next
   ctx.pipeline.mu.RUnlock()
   if next != nil {
-    next.handler.Handle(next, data)
+    next.invoke(data)
+  }
+}
+
+// 把e传给之后第一个实现了ErrorHandler的Handler，
+// 没有Handler处理时最终交给Pipeline.OnError设置的函数
+func (ctx *HandlerContext) FireError(e error) {
+  if e == nil {
+    return
+  }
+  ctx.pipeline.mu.RLock()
+  next := ctx.next
+  for next != nil {
+    if _, ok := next.handler.(ErrorHandler); ok {
+      break
+    }
+    next = next.next
+  }
+  ctx.pipeline.mu.RUnlock()
+  if next != nil {
+    next.invokeError(e)
+  }
+}
+
+func (ctx *HandlerContext) invoke(data interface{}) {
+  ctx.run(data, func() {
+    ctx.handler.Handle(ctx, data)
+  })
+}
+
+func (ctx *HandlerContext) invokeError(e error) {
+  ctx.run(errorData{e}, func() {
+    ctx.handler.(ErrorHandler).HandleError(ctx, e)
+  })
+}
+
+// 执行f（绑定了Executor时异步执行），f中的panic会转换为PanicError并通过FireError传递
+func (ctx *HandlerContext) run(data interface{}, f func()) {
+  ctx.pipeline.mu.RLock()
+  e := ctx.executor
+  ctx.pipeline.mu.RUnlock()
+  if e == nil {
+    ctx.call(f)
+    return
+  }
+  p := ctx.pipeline
+  p.pending.Inc()
+  ok := e.execute(data, func() {
+    defer p.pending.Dec()
+    ctx.call(f)
+  })
+  if !ok {
+    p.pending.Dec()
   }
 }
 
+func (ctx *HandlerContext) call(f func()) {
+  defer func() {
+    if v := recover(); v != nil {
+      // 没有被处理的PanicError（见tailHandler），继续panic直到调用方
+      if pe, ok := v.(*PanicError); ok {
+        panic(pe)
+      }
+      ctx.FireError(&PanicError{Handler: ctx.name, Value: v, Stack: debug.Stack()})
+    }
+  }()
+  f()
+}
+
+// 提交给Executor的错误，不调用Executor的key函数
+type errorData struct {
+  e error
+}
+
 type Handler interface {
   Handle(*HandlerContext, interface{})
 }
 
+// 处理FireError传递的错误，
+// 处理完后可以调用ctx.FireError继续传递（或传递另一个错误），不调用则错误到此为止
+type ErrorHandler interface {
+  HandleError(*HandlerContext, error)
+}
+
+// Handle或HandleError中的panic
+type PanicError struct {
+  // 发生panic的Handler的名字
+  Handler string
+
+  // recover()的返回值
+  Value interface{}
+
+  Stack []byte
+}
+
+func (e *PanicError) Error() string {
+  return fmt.Sprintf("pipeline: panic in handler %s: %v", e.Handler, e.Value)
+}
+
+// Value为error时返回Value
+func (e *PanicError) Unwrap() error {
+  if err, ok := e.Value.(error); ok {
+    return err
+  }
+  return nil
+}
+
 type defaultHandler struct{}
 
 func (*defaultHandler) Handle(ctx *HandlerContext, data interface{}) {
   ctx.Fire(data)
 }
+
+// 最后一个Handler，把没有处理的错误交给Pipeline.OnError设置的函数，
+// 没有设置时忽略普通的错误，PanicError则重新panic（与没有recover时一样）
+type tailHandler struct {
+  defaultHandler
+}
+
+func (*tailHandler) HandleError(ctx *HandlerContext, e error) {
+  p := ctx.pipeline
+  p.mu.RLock()
+  f := p.onError
+  p.mu.RUnlock()
+  if f != nil {
+    f(e)
+    return
+  }
+  if pe, ok := e.(*PanicError); ok {
+    panic(pe)
+  }
+}
@@ -4,6 +4,8 @@ import (
   "fmt"
   "strings"
   "sync"
+
+  "github.com/kwf2030/commons/internal/counter"
 )
 
 type Pipeline struct {
@@ -11,13 +13,24 @@ type Pipeline struct {
   tail *HandlerContext
   len  int
   mu   sync.RWMutex
+
+  // 已提交到Executor但还没处理完的数据
+  pending counter.Counter
+
+  closed bool
+
+  // 没有被ErrorHandler处理的错误
+  onError func(error)
 }
 
+// Handler中的panic会被recover并转换为PanicError，通过FireError传递给ErrorHandler，
+// 没有被处理且没有设置OnError时重新panic，因此默认行为与没有recover时一样
 func New() *Pipeline {
   p := &Pipeline{
-    head: &HandlerContext{name: "__head__", handler: &defaultHandler{}},
-    tail: &HandlerContext{name: "__tail__", handler: &defaultHandler{}},
-    mu:   sync.RWMutex{},
+    head:    &HandlerContext{name: "__head__", handler: &defaultHandler{}},
+    tail:    &HandlerContext{name: "__tail__", handler: &tailHandler{}},
+    mu:      sync.RWMutex{},
+    pending: counter.New(),
   }
   p.head.pipeline = p
   p.head.next = p.tail
@@ -26,8 +39,73 @@ func New() *Pipeline {
   return p
 }
 
+// 从第一个Handler开始处理data，
+// 没有绑定Executor的Handler在调用方的goroutine中执行，Close之后的data会被忽略
 func (p *Pipeline) Fire(data interface{}) {
-  p.head.handler.Handle(p.head, data)
+  p.mu.RLock()
+  closed := p.closed
+  p.mu.RUnlock()
+  if !closed {
+    p.head.handler.Handle(p.head, data)
+  }
+}
+
+// 从第一个Handler开始传递错误，见HandlerContext.FireError
+func (p *Pipeline) FireError(e error) {
+  p.head.FireError(e)
+}
+
+// 设置没有被任何ErrorHandler处理的错误（包括Handler中panic转换的PanicError）的处理函数，
+// f在传递错误的goroutine中调用，f中的panic会被忽略，
+// f为nil（默认）时忽略普通的错误，PanicError则以*PanicError重新panic（绑定了Executor时在worker中panic）
+func (p *Pipeline) OnError(f func(error)) *Pipeline {
+  p.mu.Lock()
+  defer p.mu.Unlock()
+  p.onError = f
+  return p
+}
+
+// 把名为name的Handler绑定到e，之后传给这个Handler的数据都提交到e中异步处理，
+// e为nil时解除绑定（恢复为同步执行），
+// 注意Block模式下，如果e的worker中的Handler再把数据传给绑定同一个e的Handler，队列满时会死锁
+func (p *Pipeline) Bind(name string, e *Executor) *Pipeline {
+  if name != "" {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if ctx := p.GetUnsafe(name); ctx != nil {
+      ctx.executor = e
+    }
+  }
+  return p
+}
+
+// 阻塞直到所有异步处理中的数据（包括处理过程中继续传递给其他异步Handler的数据）都处理完
+func (p *Pipeline) Wait() {
+  p.pending.Wait()
+}
+
+// 不再接受新的数据（Fire被忽略），等待异步处理中的数据处理完后关闭当前绑定的Executor，
+// 已经解除绑定（重新Bind或绑定nil）或Handler已经移除的Executor不会关闭
+func (p *Pipeline) Close() {
+  p.mu.Lock()
+  if p.closed {
+    p.mu.Unlock()
+    return
+  }
+  p.closed = true
+  executors := make([]*Executor, 0, 4)
+  bound := make(map[*Executor]bool, 4)
+  for ctx := p.head.next; ctx != p.tail; ctx = ctx.next {
+    if e := ctx.executor; e != nil && !bound[e] {
+      bound[e] = true
+      executors = append(executors, e)
+    }
+  }
+  p.mu.Unlock()
+  p.Wait()
+  for _, e := range executors {
+    e.Close()
+  }
 }
 
 func (p *Pipeline) AddFirst(name string, h Handler) *Pipeline {
@@ -0,0 +1,183 @@
+package pipeline
+
+import (
+  "errors"
+  "io"
+  "strconv"
+  "strings"
+  "sync"
+  "testing"
+)
+
+type funcHandler func(*HandlerContext, interface{})
+
+func (f funcHandler) Handle(ctx *HandlerContext, data interface{}) {
+  f(ctx, data)
+}
+
+func TestAsync(t *testing.T) {
+  var mu sync.Mutex
+  got := make(map[string][]int)
+  p := New().
+    AddLast("parse", funcHandler(func(ctx *HandlerContext, data interface{}) {
+      s := strings.Split(data.(string), ":")
+      n, _ := strconv.Atoi(s[1])
+      ctx.Fire([2]interface{}{s[0], n})
+    })).
+    AddLast("collect", funcHandler(func(ctx *HandlerContext, data interface{}) {
+      v := data.([2]interface{})
+      mu.Lock()
+      got[v[0].(string)] = append(got[v[0].(string)], v[1].(int))
+      mu.Unlock()
+    }))
+  p.Bind("parse", NewExecutor(2, 4, Block, nil))
+  p.Bind("collect", NewExecutor(4, 4, Block, func(data interface{}) string {
+    return data.([2]interface{})[0].(string)
+  }))
+  for i := 0; i < 100; i++ {
+    p.Fire("a:" + strconv.Itoa(i))
+    p.Fire("b:" + strconv.Itoa(i))
+  }
+  p.Wait()
+  mu.Lock()
+  if len(got["a"]) != 100 || len(got["b"]) != 100 {
+    t.Fatalf("got %d, %d", len(got["a"]), len(got["b"]))
+  }
+  mu.Unlock()
+  p.Close()
+  p.Fire("a:100")
+  p.Wait()
+  if len(got["a"]) != 100 {
+    t.Errorf("fired after close")
+  }
+
+  // key相同的数据按顺序处理
+  got = make(map[string][]int)
+  p = New().AddLast("collect", p.Get("collect").Handler())
+  p.Bind("collect", NewExecutor(4, 4, Block, func(data interface{}) string {
+    return data.([2]interface{})[0].(string)
+  }))
+  for i := 0; i < 100; i++ {
+    p.Fire([2]interface{}{"k" + strconv.Itoa(i%3), i})
+  }
+  p.Close()
+  for k, v := range got {
+    for i := 1; i < len(v); i++ {
+      if v[i] <= v[i-1] {
+        t.Fatalf("%s: out of order: %v", k, v)
+      }
+    }
+  }
+
+  // 只关闭当前绑定的Executor，重新绑定之前的由调用方自己关闭
+  e1 := NewExecutor(1, 1, Block, nil)
+  e2 := NewExecutor(1, 1, Block, nil)
+  p = New().AddLast("h", funcHandler(func(*HandlerContext, interface{}) {})).Bind("h", e1).Bind("h", e2)
+  p.Close()
+  if !e1.execute(nil, func() {}) || e2.execute(nil, func() {}) {
+    t.Error("closed unbound executor")
+  }
+  e1.Close()
+}
+
+func TestDrop(t *testing.T) {
+  block := make(chan struct{})
+  e := NewExecutor(1, 1, Drop, nil)
+  p := New().AddLast("h", funcHandler(func(ctx *HandlerContext, data interface{}) {
+    <-block
+  })).Bind("h", e)
+  for i := 0; i < 10; i++ {
+    p.Fire(i)
+  }
+  // 1个正在处理（或在队列中），最多1个排队
+  if n := e.Dropped(); n < 8 {
+    t.Errorf("got %d dropped", n)
+  }
+  close(block)
+  p.Close()
+}
+
+type errorHandler struct {
+  funcHandler
+
+  handle func(*HandlerContext, error)
+}
+
+func (h *errorHandler) HandleError(ctx *HandlerContext, e error) {
+  h.handle(ctx, e)
+}
+
+func TestFireError(t *testing.T) {
+  errBad := errors.New("bad")
+  var handled []string
+  var unhandled []error
+  p := New().
+    AddLast("check", funcHandler(func(ctx *HandlerContext, data interface{}) {
+      switch data {
+      case "bad":
+        ctx.FireError(errBad)
+      case "panic":
+        panic("boom")
+      default:
+        ctx.Fire(data)
+      }
+    })).
+    AddLast("log", &errorHandler{
+      funcHandler: func(ctx *HandlerContext, data interface{}) {
+        ctx.Fire(data)
+      },
+      handle: func(ctx *HandlerContext, e error) {
+        handled = append(handled, e.Error())
+        // 只处理errBad，其他的继续传递
+        if e != errBad {
+          ctx.FireError(e)
+        }
+      },
+    }).
+    OnError(func(e error) {
+      unhandled = append(unhandled, e)
+    })
+  p.Fire("ok")
+  p.Fire("bad")
+  p.Fire("panic")
+  if len(handled) != 2 || handled[0] != "bad" {
+    t.Errorf("got %v", handled)
+  }
+  var pe *PanicError
+  if len(unhandled) != 1 || !errors.As(unhandled[0], &pe) || pe.Handler != "check" || pe.Value != "boom" {
+    t.Fatalf("got %v", unhandled)
+  }
+
+  // 异步执行时panic同样会被recover
+  p.Bind("check", NewExecutor(1, 1, Block, func(data interface{}) string {
+    return data.(string)
+  }))
+  p.Fire("panic")
+  p.Wait()
+  if len(unhandled) != 2 {
+    t.Errorf("got %v", unhandled)
+  }
+  p.FireError(io.EOF)
+  if len(handled) != 4 || unhandled[2] != io.EOF {
+    t.Errorf("got %v, %v", handled, unhandled)
+  }
+  p.Close()
+}
+
+func TestUnhandledPanic(t *testing.T) {
+  p := New().
+    AddLast("a", funcHandler(func(ctx *HandlerContext, data interface{}) {
+      ctx.Fire(data)
+    })).
+    AddLast("b", funcHandler(func(ctx *HandlerContext, data interface{}) {
+      panic("boom")
+    }))
+  defer func() {
+    pe, ok := recover().(*PanicError)
+    if !ok || pe.Handler != "b" || pe.Value != "boom" {
+      t.Errorf("got %v", pe)
+    }
+  }()
+  p.Fire(1)
+  t.Error("expected panic")
+}
@@ -0,0 +1,446 @@
+package time2
+
+import (
+  "bufio"
+  "encoding/json"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/kwf2030/commons/base"
+)
+
+// 默认的工作日历（TimeZoneSH，周六周日休息，没有节假日），
+// 包级别的StartOfWeek、EndOfMonth等函数使用DefaultCalendar
+var DefaultCalendar = NewCalendar(nil)
+
+// 工作日历，判断某天是否工作日以及按工作日计算日期，
+// 节假日和调休（周末上班）可以通过AddHoliday/AddWorkday或从JSON/ICS文件加载，
+// 所有日期都按loc中的日期计算
+type Calendar struct {
+  loc *time.Location
+
+  // 一周的第一天，默认周一
+  firstDay time.Weekday
+
+  weekend map[time.Weekday]bool
+
+  // 节假日，key为yyyymmdd，value为节日名称
+  holidays map[int]string
+
+  // 调休上班的日期（即使是周末或节假日也上班），key为yyyymmdd
+  workdays map[int]bool
+
+  mu sync.RWMutex
+}
+
+// loc为nil时使用TimeZoneSH
+func NewCalendar(loc *time.Location) *Calendar {
+  if loc == nil {
+    loc = TimeZoneSH
+  }
+  return &Calendar{
+    loc:      loc,
+    firstDay: time.Monday,
+    weekend:  map[time.Weekday]bool{time.Saturday: true, time.Sunday: true},
+    holidays: make(map[int]string, 32),
+    workdays: make(map[int]bool, 8),
+    mu:       sync.RWMutex{},
+  }
+}
+
+func (c *Calendar) Location() *time.Location {
+  return c.loc
+}
+
+// 设置休息日（替换默认的周六周日）
+func (c *Calendar) SetWeekend(days ...time.Weekday) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  c.weekend = make(map[time.Weekday]bool, len(days))
+  for _, d := range days {
+    c.weekend[d] = true
+  }
+}
+
+// 设置一周的第一天，影响StartOfWeek/EndOfWeek
+func (c *Calendar) SetFirstDayOfWeek(d time.Weekday) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  c.firstDay = d
+}
+
+// 把t所在的日期设为节假日
+func (c *Calendar) AddHoliday(t time.Time, name string) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  c.holidays[c.key(t)] = name
+}
+
+// 把t所在的日期设为工作日（调休），优先于节假日和周末
+func (c *Calendar) AddWorkday(t time.Time) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  c.workdays[c.key(t)] = true
+}
+
+// 节假日名称，不是节假日返回false
+func (c *Calendar) Holiday(t time.Time) (string, bool) {
+  c.mu.RLock()
+  defer c.mu.RUnlock()
+  name, ok := c.holidays[c.key(t)]
+  return name, ok
+}
+
+func (c *Calendar) IsWorkday(t time.Time) bool {
+  c.mu.RLock()
+  defer c.mu.RUnlock()
+  return c.isWorkday(t)
+}
+
+func (c *Calendar) isWorkday(t time.Time) bool {
+  k := c.key(t)
+  if c.workdays[k] {
+    return true
+  }
+  if _, ok := c.holidays[k]; ok {
+    return false
+  }
+  return !c.weekend[t.In(c.loc).Weekday()]
+}
+
+// t之后（不包括t当天）的第一个工作日，时分秒与t相同
+func (c *Calendar) NextWorkday(t time.Time) time.Time {
+  return c.AddBusinessDays(t, 1)
+}
+
+// t之前（不包括t当天）的最后一个工作日，时分秒与t相同
+func (c *Calendar) PrevWorkday(t time.Time) time.Time {
+  return c.AddBusinessDays(t, -1)
+}
+
+// t之后（n为负数时之前）的第n个工作日，时分秒与t相同，n为0时返回t，
+// 没有任何工作日（如每天都是休息日）时最多查找10年，找不到返回Nil
+func (c *Calendar) AddBusinessDays(t time.Time, n int) time.Time {
+  if n == 0 {
+    return t
+  }
+  step := 1
+  if n < 0 {
+    step, n = -1, -n
+  }
+  c.mu.RLock()
+  defer c.mu.RUnlock()
+  t = t.In(c.loc)
+  for skipped := 0; n > 0; {
+    t = t.AddDate(0, 0, step)
+    if c.isWorkday(t) {
+      n--
+      skipped = 0
+    } else if skipped++; skipped > 3660 {
+      return Nil
+    }
+  }
+  return t
+}
+
+// [from, to)之间的工作日数量（按日期计算），to早于from时为负数
+func (c *Calendar) BusinessDaysBetween(from, to time.Time) int {
+  sign := 1
+  if to.Before(from) {
+    from, to, sign = to, from, -1
+  }
+  c.mu.RLock()
+  defer c.mu.RUnlock()
+  ret := 0
+  end := c.key(to)
+  for t := c.startOfDay(from); c.key(t) < end; t = t.AddDate(0, 0, 1) {
+    if c.isWorkday(t) {
+      ret++
+    }
+  }
+  return ret * sign
+}
+
+func (c *Calendar) StartOfDay(t time.Time) time.Time {
+  return c.startOfDay(t)
+}
+
+func (c *Calendar) EndOfDay(t time.Time) time.Time {
+  return c.startOfDay(t).AddDate(0, 0, 1).Add(-time.Nanosecond)
+}
+
+func (c *Calendar) StartOfWeek(t time.Time) time.Time {
+  c.mu.RLock()
+  first := c.firstDay
+  c.mu.RUnlock()
+  t = c.startOfDay(t)
+  return t.AddDate(0, 0, -((int(t.Weekday()) - int(first) + 7) % 7))
+}
+
+func (c *Calendar) EndOfWeek(t time.Time) time.Time {
+  return c.StartOfWeek(t).AddDate(0, 0, 7).Add(-time.Nanosecond)
+}
+
+func (c *Calendar) StartOfMonth(t time.Time) time.Time {
+  t = t.In(c.loc)
+  return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, c.loc)
+}
+
+func (c *Calendar) EndOfMonth(t time.Time) time.Time {
+  return c.StartOfMonth(t).AddDate(0, 1, 0).Add(-time.Nanosecond)
+}
+
+func (c *Calendar) StartOfQuarter(t time.Time) time.Time {
+  t = t.In(c.loc)
+  return time.Date(t.Year(), (t.Month()-1)/3*3+1, 1, 0, 0, 0, 0, c.loc)
+}
+
+func (c *Calendar) EndOfQuarter(t time.Time) time.Time {
+  return c.StartOfQuarter(t).AddDate(0, 3, 0).Add(-time.Nanosecond)
+}
+
+func (c *Calendar) StartOfYear(t time.Time) time.Time {
+  return time.Date(t.In(c.loc).Year(), 1, 1, 0, 0, 0, 0, c.loc)
+}
+
+func (c *Calendar) EndOfYear(t time.Time) time.Time {
+  return c.StartOfYear(t).AddDate(1, 0, 0).Add(-time.Nanosecond)
+}
+
+func (c *Calendar) startOfDay(t time.Time) time.Time {
+  t = t.In(c.loc)
+  return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, c.loc)
+}
+
+func (c *Calendar) key(t time.Time) int {
+  t = t.In(c.loc)
+  return t.Year()*10000 + int(t.Month())*100 + t.Day()
+}
+
+// 根据扩展名（.json/.ics）加载节假日
+func (c *Calendar) LoadFile(path string) error {
+  f, e := os.Open(path)
+  if e != nil {
+    return e
+  }
+  defer f.Close()
+  switch strings.ToLower(filepath.Ext(path)) {
+  case ".json":
+    return c.LoadJSON(f)
+  case ".ics", ".ical":
+    return c.LoadICS(f)
+  }
+  return fmt.Errorf("time2: unsupported calendar file %s", path)
+}
+
+// JSON格式：
+// {
+//   "holidays": [{"date": "2020-10-01", "name": "国庆节"}, ...],
+//   "workdays": ["2020-09-27", ...]
+// }
+// 日期格式为DateFormat，也可以用"from"/"to"（包含）表示连续的节假日，
+// 出错时不会加载任何日期
+func (c *Calendar) LoadJSON(r io.Reader) error {
+  var v struct {
+    Holidays []struct {
+      Date string `json:"date"`
+      From string `json:"from"`
+      To   string `json:"to"`
+      Name string `json:"name"`
+    } `json:"holidays"`
+    Workdays []string `json:"workdays"`
+  }
+  if e := json.NewDecoder(r).Decode(&v); e != nil {
+    return e
+  }
+  holidays, workdays := make(map[int]string, len(v.Holidays)), make(map[int]bool, len(v.Workdays))
+  for _, h := range v.Holidays {
+    from, to := h.From, h.To
+    if h.Date != "" {
+      from, to = h.Date, h.Date
+    }
+    start, e := time.ParseInLocation(DateFormat, from, c.loc)
+    if e != nil {
+      return e
+    }
+    end, e := time.ParseInLocation(DateFormat, to, c.loc)
+    if e != nil {
+      return e
+    }
+    for t := start; !t.After(end); t = t.AddDate(0, 0, 1) {
+      holidays[c.key(t)] = h.Name
+    }
+  }
+  for _, s := range v.Workdays {
+    t, e := time.ParseInLocation(DateFormat, s, c.loc)
+    if e != nil {
+      return e
+    }
+    workdays[c.key(t)] = true
+  }
+  c.merge(holidays, workdays)
+  return nil
+}
+
+// 加载成功后才合并，出错时不修改Calendar
+func (c *Calendar) merge(holidays map[int]string, workdays map[int]bool) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  for k, name := range holidays {
+    c.holidays[k] = name
+  }
+  for k := range workdays {
+    c.workdays[k] = true
+  }
+}
+
+// 从iCalendar（RFC 5545）中加载节假日，
+// 每个VEVENT的DTSTART到DTEND（不包含，没有DTEND时为一天）为节假日，SUMMARY为名称，
+// SUMMARY或CATEGORIES中包含"班"或"workday"的VEVENT作为调休上班日，
+// 出错时不会加载任何日期
+func (c *Calendar) LoadICS(r io.Reader) error {
+  lines, e := unfoldICS(r)
+  if e != nil {
+    return e
+  }
+  holidays, workdays := make(map[int]string, 32), make(map[int]bool, 8)
+  var start, end time.Time
+  var summary, categories string
+  inEvent := false
+  for _, line := range lines {
+    i := strings.IndexByte(line, ':')
+    if i < 0 {
+      continue
+    }
+    name, value := line[:i], line[i+1:]
+    // 去掉参数（如DTSTART;VALUE=DATE）
+    if j := strings.IndexByte(name, ';'); j >= 0 {
+      name = name[:j]
+    }
+    switch strings.ToUpper(name) {
+    case "BEGIN":
+      if strings.EqualFold(value, "VEVENT") {
+        inEvent = true
+        start, end, summary, categories = Nil, Nil, "", ""
+      }
+    case "DTSTART":
+      if start, e = c.parseICSDate(value); e != nil {
+        return e
+      }
+    case "DTEND":
+      if end, e = c.parseICSDate(value); e != nil {
+        return e
+      }
+    case "SUMMARY":
+      summary = unescapeICS(value)
+    case "CATEGORIES":
+      categories = value
+    case "END":
+      if !inEvent || !strings.EqualFold(value, "VEVENT") {
+        continue
+      }
+      inEvent = false
+      if start.IsZero() {
+        continue
+      }
+      if !end.After(start) {
+        end = start.AddDate(0, 0, 1)
+      }
+      s := strings.ToLower(summary + " " + categories)
+      workday := strings.Contains(s, "班") || strings.Contains(s, "workday")
+      for t := start; t.Before(end); t = t.AddDate(0, 0, 1) {
+        if workday {
+          workdays[c.key(t)] = true
+        } else {
+          holidays[c.key(t)] = summary
+        }
+      }
+    }
+  }
+  c.merge(holidays, workdays)
+  return nil
+}
+
+// 只取日期部分（yyyymmdd），忽略时间和时区
+func (c *Calendar) parseICSDate(s string) (time.Time, error) {
+  if len(s) < 8 {
+    return Nil, base.ErrInvalidArgument
+  }
+  return time.ParseInLocation("20060102", s[:8], c.loc)
+}
+
+// 合并折行（以空格或tab开头的行是上一行的延续）
+func unfoldICS(r io.Reader) ([]string, error) {
+  ret := make([]string, 0, 64)
+  scanner := bufio.NewScanner(r)
+  for scanner.Scan() {
+    line := strings.TrimRight(scanner.Text(), "\r")
+    if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(ret) > 0 {
+      ret[len(ret)-1] += line[1:]
+      continue
+    }
+    ret = append(ret, line)
+  }
+  return ret, scanner.Err()
+}
+
+func unescapeICS(s string) string {
+  return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+func IsWorkday(t time.Time) bool {
+  return DefaultCalendar.IsWorkday(t)
+}
+
+func NextWorkday(t time.Time) time.Time {
+  return DefaultCalendar.NextWorkday(t)
+}
+
+func AddBusinessDays(t time.Time, n int) time.Time {
+  return DefaultCalendar.AddBusinessDays(t, n)
+}
+
+func StartOfDay(t time.Time) time.Time {
+  return DefaultCalendar.StartOfDay(t)
+}
+
+func EndOfDay(t time.Time) time.Time {
+  return DefaultCalendar.EndOfDay(t)
+}
+
+func StartOfWeek(t time.Time) time.Time {
+  return DefaultCalendar.StartOfWeek(t)
+}
+
+func EndOfWeek(t time.Time) time.Time {
+  return DefaultCalendar.EndOfWeek(t)
+}
+
+func StartOfMonth(t time.Time) time.Time {
+  return DefaultCalendar.StartOfMonth(t)
+}
+
+func EndOfMonth(t time.Time) time.Time {
+  return DefaultCalendar.EndOfMonth(t)
+}
+
+func StartOfQuarter(t time.Time) time.Time {
+  return DefaultCalendar.StartOfQuarter(t)
+}
+
+func EndOfQuarter(t time.Time) time.Time {
+  return DefaultCalendar.EndOfQuarter(t)
+}
+
+func StartOfYear(t time.Time) time.Time {
+  return DefaultCalendar.StartOfYear(t)
+}
+
+func EndOfYear(t time.Time) time.Time {
+  return DefaultCalendar.EndOfYear(t)
+}
@@ -0,0 +1,88 @@
+package time2
+
+import (
+  "strings"
+  "testing"
+  "time"
+)
+
+func date(c *Calendar, s string) time.Time {
+  t, e := time.ParseInLocation(DateTimeFormatSec, s, c.Location())
+  if e != nil {
+    panic(e)
+  }
+  return t
+}
+
+func TestCalendar(t *testing.T) {
+  c := NewCalendar(nil)
+  e := c.LoadJSON(strings.NewReader(`{
+    "holidays": [{"from": "2020-10-01", "to": "2020-10-08", "name": "国庆节"}],
+    "workdays": ["2020-09-27"]
+  }`))
+  if e != nil {
+    t.Fatal(e)
+  }
+  e = c.LoadICS(strings.NewReader("BEGIN:VCALENDAR\r\n" +
+    "BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20200101\r\nDTEND;VALUE=DATE:20200102\r\nSUMMARY:元\r\n 旦\r\nEND:VEVENT\r\n" +
+    "BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20201010\r\nSUMMARY:国庆节补班\r\nEND:VEVENT\r\n" +
+    "END:VCALENDAR\r\n"))
+  if e != nil {
+    t.Fatal(e)
+  }
+  // 出错时不加载任何日期
+  e = c.LoadJSON(strings.NewReader(`{"holidays": [{"date": "2021-01-01", "name": "元旦"}], "workdays": ["bad"]}`))
+  if _, ok := c.Holiday(date(c, "2021-01-01 12:00:00")); e == nil || ok {
+    t.Errorf("expected error and no holiday, got %v, %v", e, ok)
+  }
+  e = c.LoadICS(strings.NewReader("BEGIN:VEVENT\r\nDTSTART:20210101\r\nSUMMARY:元旦\r\nEND:VEVENT\r\n" +
+    "BEGIN:VEVENT\r\nDTSTART:bad\r\nEND:VEVENT\r\n"))
+  if _, ok := c.Holiday(date(c, "2021-01-01 12:00:00")); e == nil || ok {
+    t.Errorf("expected error and no holiday, got %v, %v", e, ok)
+  }
+  if name, ok := c.Holiday(date(c, "2020-01-01 12:00:00")); !ok || name != "元旦" {
+    t.Errorf("unexpected holiday: %s, %v", name, ok)
+  }
+  cases := map[string]bool{
+    "2020-09-26 10:00:00": false,
+    "2020-09-27 10:00:00": true,
+    "2020-09-30 10:00:00": true,
+    "2020-10-05 10:00:00": false,
+    "2020-10-10 10:00:00": true,
+    "2020-10-11 10:00:00": false,
+  }
+  for s, v := range cases {
+    if c.IsWorkday(date(c, s)) != v {
+      t.Errorf("IsWorkday(%s) should be %v", s, v)
+    }
+  }
+  if v := c.NextWorkday(date(c, "2020-09-30 10:00:00")); !v.Equal(date(c, "2020-10-09 10:00:00")) {
+    t.Errorf("unexpected next workday: %v", v)
+  }
+  if v := c.AddBusinessDays(date(c, "2020-10-09 10:00:00"), -2); !v.Equal(date(c, "2020-09-29 10:00:00")) {
+    t.Errorf("unexpected business day: %v", v)
+  }
+  if n := c.BusinessDaysBetween(date(c, "2020-09-28 00:00:00"), date(c, "2020-10-12 00:00:00")); n != 5 {
+    t.Errorf("expected 5 business days, got %d", n)
+  }
+
+  now := date(c, "2020-08-13 15:04:05")
+  bounds := map[string]time.Time{
+    "2020-08-10 00:00:00": c.StartOfWeek(now),
+    "2020-08-17 00:00:00": c.EndOfWeek(now).Add(time.Nanosecond),
+    "2020-08-01 00:00:00": c.StartOfMonth(now),
+    "2020-09-01 00:00:00": c.EndOfMonth(now).Add(time.Nanosecond),
+    "2020-07-01 00:00:00": c.StartOfQuarter(now),
+    "2020-10-01 00:00:00": c.EndOfQuarter(now).Add(time.Nanosecond),
+    "2020-01-01 00:00:00": c.StartOfYear(now),
+  }
+  for s, v := range bounds {
+    if !v.Equal(date(c, s)) {
+      t.Errorf("expected %s, got %v", s, v)
+    }
+  }
+  c.SetFirstDayOfWeek(time.Sunday)
+  if v := c.StartOfWeek(now); !v.Equal(date(c, "2020-08-09 00:00:00")) {
+    t.Errorf("unexpected start of week: %v", v)
+  }
+}
@@ -0,0 +1,255 @@
+package time2
+
+import (
+  "sync"
+  "time"
+)
+
+// 时钟，TimingWheel等通过Clock获取时间和计时，
+// 测试时可以用FakeClock代替真实时钟
+type Clock interface {
+  Now() time.Time
+
+  NewTicker(d time.Duration) Ticker
+
+  After(d time.Duration) <-chan time.Time
+
+  Sleep(d time.Duration)
+}
+
+type Ticker interface {
+  C() <-chan time.Time
+
+  Stop()
+}
+
+// 真实时钟（基于time包）
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+  return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+  return &realTicker{time.NewTicker(d)}
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+  return time.After(d)
+}
+
+func (realClock) Sleep(d time.Duration) {
+  time.Sleep(d)
+}
+
+type realTicker struct {
+  *time.Ticker
+}
+
+func (t *realTicker) C() <-chan time.Time {
+  return t.Ticker.C
+}
+
+// 按绝对时间触发的Ticker，依次在start、start+d、start+2d……触发，
+// 基于Clock.After实现，误差不会累积，
+// 与time.Ticker一样，接收方来不及接收时会丢弃tick
+type alignedTicker struct {
+  c chan time.Time
+
+  stopCh chan struct{}
+
+  once sync.Once
+}
+
+func newAlignedTicker(clock Clock, start time.Time, d time.Duration) Ticker {
+  t := &alignedTicker{
+    c:      make(chan time.Time, 1),
+    stopCh: make(chan struct{}),
+  }
+  go t.run(clock, start, d)
+  return t
+}
+
+func (t *alignedTicker) run(clock Clock, next time.Time, d time.Duration) {
+  for {
+    select {
+    case now := <-clock.After(next.Sub(clock.Now())):
+      select {
+      case t.c <- now:
+      default:
+      }
+      next = next.Add(d)
+      // 落后超过一个周期时跳过已经错过的tick
+      if now = clock.Now(); !next.After(now) {
+        next = next.Add((now.Sub(next)/d + 1) * d)
+      }
+    case <-t.stopCh:
+      return
+    }
+  }
+}
+
+func (t *alignedTicker) C() <-chan time.Time {
+  return t.c
+}
+
+func (t *alignedTicker) Stop() {
+  t.once.Do(func() {
+    close(t.stopCh)
+  })
+}
+
+// 手动推进的时钟，只有调用Advance/Set时间才会变化，
+// 与time.Ticker不同，FakeClock的Ticker不会丢弃tick，
+// Advance会阻塞直到每个tick都被接收（或Ticker被Stop），
+// 因此每次推进后，接收方都已经处理完了之前的tick
+type FakeClock struct {
+  now time.Time
+
+  tickers []*fakeTicker
+
+  waiters []*fakeWaiter
+
+  mu sync.Mutex
+}
+
+func NewFakeClock(t time.Time) *FakeClock {
+  return &FakeClock{now: t, mu: sync.Mutex{}}
+}
+
+func (c *FakeClock) Now() time.Time {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  return c.now
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+  if d <= 0 {
+    panic("time2: non-positive interval for NewTicker")
+  }
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  t := &fakeTicker{
+    clock:  c,
+    d:      d,
+    next:   c.now.Add(d),
+    c:      make(chan time.Time),
+    doneCh: make(chan struct{}),
+  }
+  c.tickers = append(c.tickers, t)
+  return t
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  ch := make(chan time.Time, 1)
+  if d <= 0 {
+    ch <- c.now
+    return ch
+  }
+  c.waiters = append(c.waiters, &fakeWaiter{deadline: c.now.Add(d), c: ch})
+  return ch
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+  <-c.After(d)
+}
+
+// 把时间往后推进d，期间到期的tick和After按时间顺序依次触发
+func (c *FakeClock) Advance(d time.Duration) {
+  if d < 0 {
+    return
+  }
+  c.Set(c.Now().Add(d))
+}
+
+// 把时间设置为t，t早于当前时间时只修改时间，不触发任何事件
+func (c *FakeClock) Set(t time.Time) {
+  for {
+    c.mu.Lock()
+    if t.Before(c.now) {
+      c.now = t
+      c.mu.Unlock()
+      return
+    }
+    // 找出最早到期的事件
+    var ticker *fakeTicker
+    var waiter *fakeWaiter
+    var next time.Time
+    for _, tk := range c.tickers {
+      if !tk.next.After(t) && (ticker == nil || tk.next.Before(next)) {
+        ticker, next = tk, tk.next
+      }
+    }
+    for _, w := range c.waiters {
+      if !w.deadline.After(t) && ((ticker == nil && waiter == nil) || w.deadline.Before(next)) {
+        ticker, waiter, next = nil, w, w.deadline
+      }
+    }
+    if ticker == nil && waiter == nil {
+      c.now = t
+      c.mu.Unlock()
+      return
+    }
+    c.now = next
+    if ticker != nil {
+      ticker.next = next.Add(ticker.d)
+      c.mu.Unlock()
+      select {
+      case ticker.c <- next:
+      case <-ticker.doneCh:
+      }
+    } else {
+      for i, w := range c.waiters {
+        if w == waiter {
+          c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+          break
+        }
+      }
+      c.mu.Unlock()
+      waiter.c <- next
+    }
+  }
+}
+
+func (c *FakeClock) removeTicker(t *fakeTicker) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  for i, tk := range c.tickers {
+    if tk == t {
+      c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+      close(t.doneCh)
+      return
+    }
+  }
+}
+
+type fakeTicker struct {
+  clock *FakeClock
+
+  d time.Duration
+
+  // 下一次tick的时间
+  next time.Time
+
+  c chan time.Time
+
+  doneCh chan struct{}
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+  return t.c
+}
+
+func (t *fakeTicker) Stop() {
+  t.clock.removeTicker(t)
+}
+
+type fakeWaiter struct {
+  deadline time.Time
+
+  c chan time.Time
+}
@@ -0,0 +1,521 @@
+package time2
+
+import (
+  "fmt"
+  "sort"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+)
+
+// 计算下一次执行时间，没有下一次返回零值
+type Schedule interface {
+  Next(time.Time) time.Time
+}
+
+// 解析cron表达式，支持：
+// 5个字段（分 时 日 月 周），
+// 6个字段（秒 分 时 日 月 周），
+// @yearly/@annually/@monthly/@weekly/@daily/@midnight/@hourly，
+// @every <duration>（如@every 1h30m），
+// 表达式前可以用"CRON_TZ=Asia/Shanghai "或"TZ=Asia/Shanghai "指定时区，
+// 未指定时区时使用loc，loc为nil时使用time.Local
+func ParseCron(spec string, loc *time.Location) (Schedule, error) {
+  spec = strings.TrimSpace(spec)
+  if spec == "" {
+    return nil, fmt.Errorf("cron: empty spec")
+  }
+  if loc == nil {
+    loc = time.Local
+  }
+  if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+    i := strings.IndexByte(spec, ' ')
+    if i == -1 {
+      return nil, fmt.Errorf("cron: missing fields after time zone: %s", spec)
+    }
+    name := spec[strings.IndexByte(spec, '=')+1 : i]
+    l, e := time.LoadLocation(name)
+    if e != nil {
+      return nil, fmt.Errorf("cron: invalid time zone %s: %v", name, e)
+    }
+    loc = l
+    spec = strings.TrimSpace(spec[i:])
+  }
+  if strings.HasPrefix(spec, "@") {
+    return parseDescriptor(spec, loc)
+  }
+  fields := strings.Fields(spec)
+  switch len(fields) {
+  case 5:
+    fields = append([]string{"0"}, fields...)
+  case 6:
+  default:
+    return nil, fmt.Errorf("cron: expected 5 or 6 fields, found %d: %s", len(fields), spec)
+  }
+  s := &cronSchedule{loc: loc}
+  var e error
+  if s.second, e = parseField(fields[0], seconds); e != nil {
+    return nil, e
+  }
+  if s.minute, e = parseField(fields[1], minutes); e != nil {
+    return nil, e
+  }
+  if s.hour, e = parseField(fields[2], hours); e != nil {
+    return nil, e
+  }
+  if s.dom, e = parseField(fields[3], doms); e != nil {
+    return nil, e
+  }
+  if s.month, e = parseField(fields[4], months); e != nil {
+    return nil, e
+  }
+  if s.dow, e = parseField(fields[5], dows); e != nil {
+    return nil, e
+  }
+  // 周日既可以是0也可以是7
+  if s.dow&(1<<7) != 0 {
+    s.dow = s.dow&^(1<<7) | 1
+  }
+  return s, nil
+}
+
+func parseDescriptor(spec string, loc *time.Location) (Schedule, error) {
+  all := func(b bounds) uint64 {
+    return bitRange(b.min, b.max, 1) | starBit
+  }
+  s := &cronSchedule{
+    second: 1 << 0,
+    minute: 1 << 0,
+    hour:   1 << 0,
+    dom:    1 << 1,
+    month:  1 << 1,
+    dow:    all(dows),
+    loc:    loc,
+  }
+  switch spec {
+  case "@yearly", "@annually":
+  case "@monthly":
+    s.month = all(months)
+  case "@weekly":
+    s.dom = all(doms)
+    s.month = all(months)
+    s.dow = 1 << 0
+  case "@daily", "@midnight":
+    s.dom = all(doms)
+    s.month = all(months)
+  case "@hourly":
+    s.hour = all(hours)
+    s.dom = all(doms)
+    s.month = all(months)
+  default:
+    if strings.HasPrefix(spec, "@every ") {
+      d, e := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+      if e != nil {
+        return nil, fmt.Errorf("cron: invalid duration %s: %v", spec, e)
+      }
+      if d < time.Second {
+        return nil, fmt.Errorf("cron: duration must be at least 1s: %s", spec)
+      }
+      return &everySchedule{d: d}, nil
+    }
+    return nil, fmt.Errorf("cron: unrecognized descriptor %s", spec)
+  }
+  return s, nil
+}
+
+type bounds struct {
+  min, max int
+  names    map[string]int
+}
+
+var (
+  seconds = bounds{0, 59, nil}
+  minutes = bounds{0, 59, nil}
+  hours   = bounds{0, 23, nil}
+  doms    = bounds{1, 31, nil}
+  months  = bounds{1, 12, map[string]int{
+    "jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+    "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+  }}
+  dows = bounds{0, 7, map[string]int{
+    "sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+  }}
+)
+
+// 字段为*或?时设置该位，用于区分日和周的匹配方式
+const starBit = 1 << 63
+
+// 解析一个字段（如"1-5/2,10"），每一位表示对应的值是否匹配
+func parseField(field string, b bounds) (uint64, error) {
+  var bits uint64
+  for _, expr := range strings.Split(field, ",") {
+    var start, end, step int
+    var e error
+    rangeAndStep := strings.Split(expr, "/")
+    lowAndHigh := strings.Split(rangeAndStep[0], "-")
+    star := false
+    if lowAndHigh[0] == "*" || lowAndHigh[0] == "?" {
+      if len(lowAndHigh) > 1 {
+        return 0, fmt.Errorf("cron: invalid range %s", expr)
+      }
+      start, end, star = b.min, b.max, true
+    } else {
+      if start, e = parseValue(lowAndHigh[0], b); e != nil {
+        return 0, e
+      }
+      switch len(lowAndHigh) {
+      case 1:
+        end = start
+      case 2:
+        if end, e = parseValue(lowAndHigh[1], b); e != nil {
+          return 0, e
+        }
+      default:
+        return 0, fmt.Errorf("cron: too many hyphens in %s", expr)
+      }
+    }
+    switch len(rangeAndStep) {
+    case 1:
+      step = 1
+    case 2:
+      if step, e = strconv.Atoi(rangeAndStep[1]); e != nil || step <= 0 {
+        return 0, fmt.Errorf("cron: invalid step in %s", expr)
+      }
+      // "N/step"表示从N到最大值
+      if len(lowAndHigh) == 1 && !star {
+        end = b.max
+      }
+      star = false
+    default:
+      return 0, fmt.Errorf("cron: too many slashes in %s", expr)
+    }
+    if start < b.min || end > b.max || start > end {
+      return 0, fmt.Errorf("cron: %s out of range [%d, %d]", expr, b.min, b.max)
+    }
+    bits |= bitRange(start, end, step)
+    if star {
+      bits |= starBit
+    }
+  }
+  return bits, nil
+}
+
+func parseValue(s string, b bounds) (int, error) {
+  if b.names != nil {
+    if v, ok := b.names[strings.ToLower(s)]; ok {
+      return v, nil
+    }
+  }
+  v, e := strconv.Atoi(s)
+  if e != nil {
+    return 0, fmt.Errorf("cron: invalid value %s", s)
+  }
+  return v, nil
+}
+
+func bitRange(min, max, step int) uint64 {
+  var bits uint64
+  for i := min; i <= max; i += step {
+    bits |= 1 << uint(i)
+  }
+  return bits
+}
+
+type cronSchedule struct {
+  second, minute, hour, dom, month, dow uint64
+
+  loc *time.Location
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+  origin := t.Location()
+  t = t.In(s.loc)
+  // 从下一秒开始找
+  t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+  // 是否已经调整过时间，调整过之后更低的字段都要从0开始
+  added := false
+  // 最多往后找5年，防止类似2月30日这种永远不会匹配的表达式死循环
+  yearLimit := t.Year() + 5
+
+WRAP:
+  if t.Year() > yearLimit {
+    return Nil
+  }
+
+  for 1<<uint(t.Month())&s.month == 0 {
+    if !added {
+      added = true
+      t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, s.loc)
+    }
+    t = t.AddDate(0, 1, 0)
+    if t.Month() == time.January {
+      goto WRAP
+    }
+  }
+
+  for !s.dayMatches(t) {
+    if !added {
+      added = true
+      t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.loc)
+    }
+    t = t.AddDate(0, 0, 1)
+    // 夏令时切换可能导致跨天后不是0点
+    if t.Hour() != 0 {
+      if t.Hour() > 12 {
+        t = t.Add(time.Duration(24-t.Hour()) * time.Hour)
+      } else {
+        t = t.Add(time.Duration(-t.Hour()) * time.Hour)
+      }
+    }
+    if t.Day() == 1 {
+      goto WRAP
+    }
+  }
+
+  for 1<<uint(t.Hour())&s.hour == 0 {
+    if !added {
+      added = true
+      t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, s.loc)
+    }
+    t = t.Add(time.Hour)
+    if t.Hour() == 0 {
+      goto WRAP
+    }
+  }
+
+  for 1<<uint(t.Minute())&s.minute == 0 {
+    if !added {
+      added = true
+      t = t.Truncate(time.Minute)
+    }
+    t = t.Add(time.Minute)
+    if t.Minute() == 0 {
+      goto WRAP
+    }
+  }
+
+  for 1<<uint(t.Second())&s.second == 0 {
+    if !added {
+      added = true
+      t = t.Truncate(time.Second)
+    }
+    t = t.Add(time.Second)
+    if t.Second() == 0 {
+      goto WRAP
+    }
+  }
+
+  return t.In(origin)
+}
+
+// 日和周都不是*时满足其一即可，否则两者都要满足
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+  domMatch := 1<<uint(t.Day())&s.dom != 0
+  dowMatch := 1<<uint(t.Weekday())&s.dow != 0
+  if s.dom&starBit != 0 || s.dow&starBit != 0 {
+    return domMatch && dowMatch
+  }
+  return domMatch || dowMatch
+}
+
+type everySchedule struct {
+  d time.Duration
+}
+
+func (s *everySchedule) Next(t time.Time) time.Time {
+  return t.Add(s.d - time.Duration(t.Nanosecond())%time.Second)
+}
+
+type CronEntry struct {
+  ID uint64
+
+  // cron表达式，通过AddSchedule添加的为空
+  Spec string
+
+  Schedule Schedule
+
+  // 下一次执行时间，Cron未启动时为零值
+  Next time.Time
+
+  // 上一次执行时间，还没执行过为零值
+  Prev time.Time
+
+  data interface{}
+
+  f func(uint64, interface{})
+
+  // 在时间轮中的task id
+  taskID uint64
+}
+
+// 基于TimingWheel的cron调度器，执行精度取决于时间轮的精度
+type Cron struct {
+  tw *TimingWheel
+
+  loc *time.Location
+
+  entries map[uint64]*CronEntry
+
+  lastID uint64
+
+  running bool
+
+  mu sync.Mutex
+}
+
+// tw为nil时使用DefaultTimingWheel，
+// loc为表达式默认时区（如TimeZoneSH），为nil时使用time.Local
+func NewCron(tw *TimingWheel, loc *time.Location) *Cron {
+  if tw == nil {
+    tw = DefaultTimingWheel
+  }
+  if loc == nil {
+    loc = time.Local
+  }
+  return &Cron{
+    tw:      tw,
+    loc:     loc,
+    entries: make(map[uint64]*CronEntry, 16),
+    mu:      sync.Mutex{},
+  }
+}
+
+// 添加一个cron任务，返回entry id，f的第一个参数为entry id
+func (c *Cron) Add(spec string, data interface{}, f func(uint64, interface{})) (uint64, error) {
+  if f == nil {
+    return 0, fmt.Errorf("cron: nil func")
+  }
+  s, e := ParseCron(spec, c.loc)
+  if e != nil {
+    return 0, e
+  }
+  return c.add(spec, s, data, f), nil
+}
+
+func (c *Cron) AddSchedule(s Schedule, data interface{}, f func(uint64, interface{})) uint64 {
+  if s == nil || f == nil {
+    return 0
+  }
+  return c.add("", s, data, f)
+}
+
+func (c *Cron) add(spec string, s Schedule, data interface{}, f func(uint64, interface{})) uint64 {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  c.lastID++
+  entry := &CronEntry{
+    ID:       c.lastID,
+    Spec:     spec,
+    Schedule: s,
+    data:     data,
+    f:        f,
+  }
+  c.entries[entry.ID] = entry
+  if c.running {
+    c.schedule(entry, c.tw.clock.Now())
+  }
+  return entry.ID
+}
+
+func (c *Cron) Remove(id uint64) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  if entry, ok := c.entries[id]; ok {
+    c.tw.Cancel(entry.taskID)
+    delete(c.entries, id)
+  }
+}
+
+// 所有entry的快照，按下一次执行时间排序
+func (c *Cron) Entries() []CronEntry {
+  c.mu.Lock()
+  ret := make([]CronEntry, 0, len(c.entries))
+  for _, entry := range c.entries {
+    ret = append(ret, *entry)
+  }
+  c.mu.Unlock()
+  sort.Slice(ret, func(i, j int) bool {
+    if ret[i].Next.IsZero() != ret[j].Next.IsZero() {
+      return ret[j].Next.IsZero()
+    }
+    if ret[i].Next.Equal(ret[j].Next) {
+      return ret[i].ID < ret[j].ID
+    }
+    return ret[i].Next.Before(ret[j].Next)
+  })
+  return ret
+}
+
+func (c *Cron) Entry(id uint64) (CronEntry, bool) {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  if entry, ok := c.entries[id]; ok {
+    return *entry, true
+  }
+  return CronEntry{}, false
+}
+
+// 启动调度，同时会启动时间轮
+func (c *Cron) Start() {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  if c.running {
+    return
+  }
+  c.running = true
+  c.tw.Start()
+  now := c.tw.clock.Now()
+  for _, entry := range c.entries {
+    c.schedule(entry, now)
+  }
+}
+
+// 停止调度（不会停止时间轮），正在执行的任务不受影响
+func (c *Cron) Stop() {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  if !c.running {
+    return
+  }
+  c.running = false
+  for _, entry := range c.entries {
+    c.tw.Cancel(entry.taskID)
+    entry.taskID = 0
+    entry.Next = Nil
+  }
+}
+
+func (c *Cron) schedule(entry *CronEntry, now time.Time) {
+  entry.Next = entry.Schedule.Next(now.In(c.loc))
+  if entry.Next.IsZero() {
+    entry.taskID = 0
+    return
+  }
+  // At不接受过去的时间，至少延迟一个slot
+  d := entry.Next.Sub(now)
+  if d <= 0 {
+    d = c.tw.dps
+  }
+  entry.taskID = c.tw.Delay(d, entry, c.run)
+}
+
+func (c *Cron) run(taskID uint64, data interface{}) {
+  entry := data.(*CronEntry)
+  c.mu.Lock()
+  if !c.running || c.entries[entry.ID] != entry || entry.taskID != taskID {
+    c.mu.Unlock()
+    return
+  }
+  entry.Prev = entry.Next
+  // 时间轮可能提前或推迟不到一个slot执行，以计划时间和当前时间中较晚的为基准，
+  // 避免同一时间点执行两次
+  now := c.tw.clock.Now()
+  if entry.Prev.After(now) {
+    now = entry.Prev
+  }
+  c.schedule(entry, now)
+  id, f, d := entry.ID, entry.f, entry.data
+  c.mu.Unlock()
+  f(id, d)
+}
@@ -0,0 +1,85 @@
+package time2
+
+import (
+  "sync"
+  "testing"
+  "time"
+)
+
+func TestParseCron(t *testing.T) {
+  cases := []struct {
+    spec     string
+    from     string
+    expected string
+  }{
+    {"* * * * *", "2020-01-01 00:00:00", "2020-01-01 00:01:00"},
+    {"*/15 * * * * *", "2020-01-01 00:00:07", "2020-01-01 00:00:15"},
+    {"0 30 9 * * MON-FRI", "2020-01-03 10:00:00", "2020-01-06 09:30:00"},
+    {"0 0 1 1 *", "2020-06-01 00:00:00", "2021-01-01 00:00:00"},
+    {"0 0 29 2 *", "2021-01-01 00:00:00", "2024-02-29 00:00:00"},
+    {"0 12 1,15 * 7", "2020-03-02 00:00:00", "2020-03-08 12:00:00"},
+    {"5/20 * * * *", "2020-01-01 00:30:00", "2020-01-01 00:45:00"},
+    {"@daily", "2020-01-01 13:00:00", "2020-01-02 00:00:00"},
+    {"@weekly", "2020-01-01 13:00:00", "2020-01-05 00:00:00"},
+    {"@monthly", "2020-01-31 13:00:00", "2020-02-01 00:00:00"},
+    {"@yearly", "2020-01-31 13:00:00", "2021-01-01 00:00:00"},
+    {"@hourly", "2020-01-31 13:00:00", "2020-01-31 14:00:00"},
+    {"@every 1h30m", "2020-01-31 13:00:00", "2020-01-31 14:30:00"},
+  }
+  for _, c := range cases {
+    s, e := ParseCron(c.spec, TimeZoneSH)
+    if e != nil {
+      t.Errorf("%s: %v", c.spec, e)
+      continue
+    }
+    from, _ := time.ParseInLocation(DateTimeFormatSec, c.from, TimeZoneSH)
+    if next := s.Next(from).Format(DateTimeFormatSec); next != c.expected {
+      t.Errorf("%s: from %s, expected %s, got %s", c.spec, c.from, c.expected, next)
+    }
+  }
+
+  s, _ := ParseCron("CRON_TZ=UTC 0 0 * * *", TimeZoneSH)
+  from, _ := time.ParseInLocation(DateTimeFormatSec, "2020-01-01 00:00:00", TimeZoneSH)
+  if next := s.Next(from).Format(DateTimeFormatSec); next != "2020-01-01 08:00:00" {
+    t.Errorf("CRON_TZ: expected 2020-01-01 08:00:00, got %s", next)
+  }
+
+  for _, spec := range []string{"", "* * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "@foo", "TZ=Foo/Bar * * * * *"} {
+    if _, e := ParseCron(spec, nil); e == nil {
+      t.Errorf("%q: expected error", spec)
+    }
+  }
+}
+
+func TestCron(t *testing.T) {
+  tw, clock := newFakeTimingWheel(10, time.Millisecond*100)
+  defer tw.Stop()
+  c := NewCron(tw, TimeZoneSH)
+  var wg sync.WaitGroup
+  wg.Add(2)
+  var once sync.Once
+  id, e := c.Add("* * * * * *", "data", func(id uint64, data interface{}) {
+    wg.Done()
+  })
+  if e != nil {
+    t.Fatal(e)
+  }
+  id2, _ := c.Add("@yearly", nil, func(uint64, interface{}) {
+    once.Do(func() { t.Error("should not run") })
+  })
+  c.Start()
+  advanceUntil(t, clock, time.Millisecond*100, time.Second*3, &wg)
+  entry, ok := c.Entry(id)
+  if !ok || entry.Prev.IsZero() || !entry.Next.After(entry.Prev) {
+    t.Errorf("unexpected entry: %+v", entry)
+  }
+  entries := c.Entries()
+  if len(entries) != 2 || entries[0].ID != id || entries[1].ID != id2 {
+    t.Errorf("unexpected entries: %+v", entries)
+  }
+  c.Remove(id)
+  if _, ok := c.Entry(id); ok {
+    t.Error("entry not removed")
+  }
+  c.Stop()
+}
@@ -0,0 +1,277 @@
+package time2
+
+import (
+  "sync"
+  "time"
+)
+
+const (
+  // 一连串调用结束（wait时间内没有再调用）后执行
+  Trailing = iota
+  // 一连串调用的第一次立即执行，之后的调用忽略
+  Leading
+  // 第一次立即执行，之后还有调用的话结束时再执行一次
+  BothEdges
+)
+
+type DebounceOption struct {
+  // Trailing/Leading/BothEdges
+  Edge int
+
+  // 一连串调用持续超过MaxWait时也执行一次（如果有需要执行的调用），<=0表示不限
+  MaxWait time.Duration
+}
+
+// 防抖，一连串间隔不超过wait的调用只执行一次f，
+// f在Call的goroutine（Leading）或内部的goroutine（Trailing）中执行
+type Debouncer struct {
+  clock Clock
+
+  wait time.Duration
+
+  maxWait time.Duration
+
+  edge int
+
+  f func()
+
+  // 是否在一连串调用中
+  active bool
+
+  // 结束时是否需要执行
+  pending bool
+
+  // 本轮的开始时间（MaxWait从这里开始算）和最后一次调用的时间
+  first time.Time
+  last  time.Time
+
+  // 每轮调用结束（或Cancel/Flush）时加1，用于停止上一轮的goroutine
+  gen uint64
+
+  mu sync.Mutex
+}
+
+// clock为nil时使用RealClock，opt为nil时为Trailing且不限MaxWait
+func NewDebouncer(clock Clock, wait time.Duration, opt *DebounceOption, f func()) *Debouncer {
+  if wait <= 0 || f == nil {
+    return nil
+  }
+  if clock == nil {
+    clock = RealClock
+  }
+  if opt == nil {
+    opt = &DebounceOption{}
+  }
+  return &Debouncer{
+    clock:   clock,
+    wait:    wait,
+    maxWait: opt.MaxWait,
+    edge:    opt.Edge,
+    f:       f,
+    mu:      sync.Mutex{},
+  }
+}
+
+func (d *Debouncer) Call() {
+  d.mu.Lock()
+  now := d.clock.Now()
+  if d.active && !d.pending && !now.Before(d.last.Add(d.wait)) {
+    // 上一轮已经结束（没有需要执行的调用），只是goroutine还没来得及处理，直接开始新的一轮，
+    // 这样是否开始新的一轮只取决于时钟，与goroutine的调度无关
+    d.reset()
+  }
+  d.last = now
+  if d.active {
+    if d.edge != Leading {
+      d.pending = true
+    }
+    d.mu.Unlock()
+    return
+  }
+  d.active = true
+  d.first = now
+  d.pending = d.edge == Trailing
+  // 在Call返回前开始计时，FakeClock推进时间时不会错过
+  ch := d.clock.After(d.wait)
+  go d.run(d.gen, ch)
+  d.mu.Unlock()
+  if d.edge != Trailing {
+    d.f()
+  }
+}
+
+// 取消还没执行的调用
+func (d *Debouncer) Cancel() {
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  d.reset()
+}
+
+// 有还没执行的调用时立即执行
+func (d *Debouncer) Flush() {
+  d.mu.Lock()
+  fire := d.active && d.pending
+  d.reset()
+  d.mu.Unlock()
+  if fire {
+    d.f()
+  }
+}
+
+// 是否有还没执行的调用
+func (d *Debouncer) Pending() bool {
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  return d.active && d.pending
+}
+
+func (d *Debouncer) reset() {
+  d.active = false
+  d.pending = false
+  d.gen++
+}
+
+func (d *Debouncer) run(gen uint64, ch <-chan time.Time) {
+  for {
+    <-ch
+    d.mu.Lock()
+    if d.gen != gen {
+      d.mu.Unlock()
+      return
+    }
+    now := d.clock.Now()
+    deadline := d.last.Add(d.wait)
+    maxed := false
+    if d.maxWait > 0 {
+      if t := d.first.Add(d.maxWait); t.Before(deadline) {
+        deadline, maxed = t, true
+      }
+    }
+    if wait := deadline.Sub(now); wait > 0 {
+      ch = d.clock.After(wait)
+      d.mu.Unlock()
+      continue
+    }
+    fire := d.pending
+    if maxed {
+      // 达到MaxWait但调用还在继续，开始新的一轮
+      d.first = now
+      d.pending = false
+      ch = d.clock.After(d.last.Add(d.wait).Sub(now))
+    } else {
+      d.reset()
+    }
+    d.mu.Unlock()
+    if fire {
+      d.f()
+    }
+    if !maxed {
+      return
+    }
+  }
+}
+
+// 节流，f每interval最多执行一次（两次执行的间隔不小于interval），
+// 距上次执行已经超过interval时立即执行，否则合并为一次在上次执行interval之后执行，
+// f在Call的goroutine（立即执行时）或内部的goroutine中执行
+type Throttler struct {
+  clock Clock
+
+  interval time.Duration
+
+  f func()
+
+  // 是否执行过和最后一次执行的时间
+  fired bool
+  last  time.Time
+
+  // 是否有等待执行的调用
+  pending bool
+
+  // Cancel/Flush时加1，用于停止等待中的goroutine
+  gen uint64
+
+  mu sync.Mutex
+}
+
+// clock为nil时使用RealClock
+func NewThrottler(clock Clock, interval time.Duration, f func()) *Throttler {
+  if interval <= 0 || f == nil {
+    return nil
+  }
+  if clock == nil {
+    clock = RealClock
+  }
+  return &Throttler{
+    clock:    clock,
+    interval: interval,
+    f:        f,
+    mu:       sync.Mutex{},
+  }
+}
+
+func (t *Throttler) Call() {
+  t.mu.Lock()
+  if t.pending {
+    t.mu.Unlock()
+    return
+  }
+  now := t.clock.Now()
+  next := t.last.Add(t.interval)
+  if !t.fired || !next.After(now) {
+    t.fired = true
+    t.last = now
+    t.mu.Unlock()
+    t.f()
+    return
+  }
+  t.pending = true
+  // 在Call返回前开始计时，FakeClock推进时间时不会错过
+  ch := t.clock.After(next.Sub(now))
+  go t.run(t.gen, ch)
+  t.mu.Unlock()
+}
+
+// 取消等待执行的调用
+func (t *Throttler) Cancel() {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  t.pending = false
+  t.gen++
+}
+
+// 有等待执行的调用时立即执行
+func (t *Throttler) Flush() {
+  t.mu.Lock()
+  fire := t.pending
+  if fire {
+    t.pending = false
+    t.gen++
+    t.last = t.clock.Now()
+  }
+  t.mu.Unlock()
+  if fire {
+    t.f()
+  }
+}
+
+// 是否有等待执行的调用
+func (t *Throttler) Pending() bool {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  return t.pending
+}
+
+func (t *Throttler) run(gen uint64, ch <-chan time.Time) {
+  // 以计时到期的时间作为执行时间，不受goroutine调度延迟的影响
+  now := <-ch
+  t.mu.Lock()
+  if t.gen != gen {
+    t.mu.Unlock()
+    return
+  }
+  t.pending = false
+  t.last = now
+  t.mu.Unlock()
+  t.f()
+}
@@ -0,0 +1,137 @@
+package time2
+
+import (
+  "testing"
+  "time"
+)
+
+// 每次推进step，直到收到执行时间或推进了max
+func advanceFire(t *testing.T, clock *FakeClock, step, max time.Duration, fired chan time.Time) time.Time {
+  for d := time.Duration(0); d <= max; d += step {
+    select {
+    case v := <-fired:
+      return v
+    case <-time.After(time.Millisecond * 5):
+      clock.Advance(step)
+    }
+  }
+  t.Fatalf("not fired after %v", max)
+  return time.Time{}
+}
+
+func TestDebouncer(t *testing.T) {
+  clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+  start := clock.Now()
+  fired := make(chan time.Time, 16)
+  f := func() {
+    fired <- clock.Now()
+  }
+
+  d := NewDebouncer(clock, time.Millisecond*100, nil, f)
+  d.Call()
+  clock.Advance(time.Millisecond * 50)
+  d.Call()
+  clock.Advance(time.Millisecond * 50)
+  d.Call()
+  if e := advanceFire(t, clock, time.Millisecond*10, time.Second, fired).Sub(start); e < time.Millisecond*200 {
+    t.Errorf("trailing fired after %v", e)
+  }
+
+  start = clock.Now()
+  d = NewDebouncer(clock, time.Millisecond*100, &DebounceOption{Edge: Leading}, f)
+  d.Call()
+  if v := <-fired; !v.Equal(start) {
+    t.Errorf("leading fired at %v", v)
+  }
+  d.Call()
+  if len(fired) != 0 {
+    t.Error("leading fired twice in one round")
+  }
+  // 上一轮已经结束，Leading在Call中立即执行
+  clock.Advance(time.Millisecond * 200)
+  d.Call()
+  select {
+  case v := <-fired:
+    if v.Sub(start) < time.Millisecond*200 {
+      t.Errorf("leading fired at %v", v)
+    }
+  default:
+    t.Error("leading not fired in new round")
+  }
+
+  // 一直调用，MaxWait时也要执行
+  start = clock.Now()
+  d = NewDebouncer(clock, time.Millisecond*100, &DebounceOption{MaxWait: time.Millisecond * 300}, f)
+  for i := 0; i < 40; i++ {
+    d.Call()
+    clock.Advance(time.Millisecond * 10)
+    select {
+    case v := <-fired:
+      if e := v.Sub(start); e < time.Millisecond*300 || e > time.Millisecond*320 {
+        t.Errorf("max wait fired after %v", e)
+      }
+      i = 40
+    default:
+    }
+  }
+
+  d = NewDebouncer(clock, time.Millisecond*100, nil, f)
+  d.Call()
+  d.Cancel()
+  d.Call()
+  d.Flush()
+  if d.Pending() || len(fired) != 1 {
+    t.Errorf("unexpected flush result")
+  }
+  <-fired
+}
+
+func TestThrottler(t *testing.T) {
+  clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+  start := clock.Now()
+  fired := make(chan time.Time, 16)
+  th := NewThrottler(clock, time.Millisecond*100, func() {
+    fired <- clock.Now()
+  })
+  th.Call()
+  th.Call()
+  if v := <-fired; !v.Equal(start) {
+    t.Errorf("first call fired at %v", v)
+  }
+  if e := advanceFire(t, clock, time.Millisecond*10, time.Second, fired).Sub(start); e < time.Millisecond*100 {
+    t.Errorf("trailing fired after %v", e)
+  }
+
+  // 两次执行的间隔不小于interval
+  clock = NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+  start = clock.Now()
+  th = NewThrottler(clock, time.Millisecond*100, func() {
+    fired <- clock.Now()
+  })
+  th.Call()
+  if v := <-fired; !v.Equal(start) {
+    t.Errorf("t=0 fired at %v", v.Sub(start))
+  }
+  clock.Advance(time.Millisecond * 50)
+  th.Call()
+  if e := advanceFire(t, clock, time.Millisecond, time.Second, fired).Sub(start); e < time.Millisecond*100 {
+    t.Errorf("t=50 fired at %v", e)
+  }
+  clock.Set(start.Add(time.Millisecond * 151))
+  th.Call()
+  if e := advanceFire(t, clock, time.Millisecond, time.Second, fired).Sub(start); e < time.Millisecond*200 {
+    t.Errorf("t=151 fired at %v", e)
+  }
+
+  th.Call()
+  if !th.Pending() {
+    t.Error("expected pending")
+  }
+  th.Cancel()
+  th.Call()
+  th.Flush()
+  if th.Pending() || len(fired) != 1 {
+    t.Error("unexpected flush result")
+  }
+  <-fired
+}
@@ -0,0 +1,259 @@
+package time2
+
+import (
+  "container/heap"
+  "sync"
+  "time"
+)
+
+// TimingWheel和DelayQueue的公共接口，
+// task数量多、对精度要求不高时用TimingWheel，
+// task数量少、需要在准确的时间执行时用DelayQueue
+type Scheduler interface {
+  Start()
+
+  Stop()
+
+  // 延迟delay后执行f，返回task id，参数错误返回0
+  Delay(delay time.Duration, data interface{}, f func(uint64, interface{})) uint64
+
+  // 在t执行f，t不晚于当前时间返回0
+  At(t time.Time, data interface{}, f func(uint64, interface{})) uint64
+
+  // 取消还没执行的task，返回是否真的移除了
+  Cancel(id uint64) bool
+}
+
+var (
+  _ Scheduler = (*TimingWheel)(nil)
+  _ Scheduler = (*DelayQueue)(nil)
+)
+
+// 基于最小堆的延迟队列，
+// 每次等待到最早的task的执行时间，添加/取消为O(log n)，
+// 不会像TimingWheel那样按slot取整
+type DelayQueue struct {
+  state int
+
+  clock Clock
+
+  executor Executor
+
+  seq uint64
+
+  // 按执行时间排序的最小堆
+  items delayHeap
+
+  // 所有未执行的task，key为task id
+  index map[uint64]*delayItem
+
+  // 最早的task变化时通知run重新计时
+  wakeChan chan struct{}
+  // 计时器停止信号
+  stopChan chan struct{}
+  // run退出时关闭
+  doneChan chan struct{}
+
+  mu sync.Mutex
+}
+
+// clock为nil时使用RealClock，executor为nil时每个task启动一个goroutine执行
+func NewDelayQueue(clock Clock, executor Executor) *DelayQueue {
+  if clock == nil {
+    clock = RealClock
+  }
+  if executor == nil {
+    executor = newGoExecutor()
+  }
+  return &DelayQueue{
+    state:    ready,
+    clock:    clock,
+    executor: executor,
+    items:    make(delayHeap, 0, 64),
+    index:    make(map[uint64]*delayItem, 64),
+    wakeChan: make(chan struct{}, 1),
+    mu:       sync.Mutex{},
+  }
+}
+
+// 停止之后可以再次启动，与TimingWheel不同，
+// 停止期间时间照常流逝，再次启动后已经过期的task会立即执行
+func (q *DelayQueue) Start() {
+  q.mu.Lock()
+  defer q.mu.Unlock()
+  if q.state == running {
+    return
+  }
+  q.state = running
+  q.stopChan = make(chan struct{})
+  q.doneChan = make(chan struct{})
+  go q.run(q.stopChan, q.doneChan)
+}
+
+func (q *DelayQueue) Stop() {
+  q.mu.Lock()
+  defer q.mu.Unlock()
+  if q.state != running {
+    return
+  }
+  q.state = stopped
+  close(q.stopChan)
+}
+
+// 停止并等待已经提交给Executor的task执行完
+func (q *DelayQueue) StopAndWait() {
+  q.mu.Lock()
+  done := q.doneChan
+  q.mu.Unlock()
+  q.Stop()
+  if done != nil {
+    <-done
+  }
+  q.executor.Wait()
+}
+
+func (q *DelayQueue) Delay(delay time.Duration, data interface{}, f func(uint64, interface{})) uint64 {
+  if delay <= 0 || f == nil {
+    return 0
+  }
+  return q.add(q.clock.Now().Add(delay), data, f)
+}
+
+func (q *DelayQueue) At(t time.Time, data interface{}, f func(uint64, interface{})) uint64 {
+  if f == nil || !t.After(q.clock.Now()) {
+    return 0
+  }
+  return q.add(t, data, f)
+}
+
+func (q *DelayQueue) add(deadline time.Time, data interface{}, f func(uint64, interface{})) uint64 {
+  q.mu.Lock()
+  defer q.mu.Unlock()
+  q.seq++
+  item := &delayItem{
+    id:       q.seq,
+    deadline: deadline,
+    data:     data,
+    f:        f,
+  }
+  q.index[item.id] = item
+  heap.Push(&q.items, item)
+  if item.index == 0 {
+    q.wake()
+  }
+  return item.id
+}
+
+func (q *DelayQueue) Cancel(id uint64) bool {
+  q.mu.Lock()
+  defer q.mu.Unlock()
+  item, ok := q.index[id]
+  if !ok {
+    return false
+  }
+  delete(q.index, id)
+  head := item.index == 0
+  heap.Remove(&q.items, item.index)
+  if head {
+    q.wake()
+  }
+  return true
+}
+
+// 还没执行的task数量
+func (q *DelayQueue) Len() int {
+  q.mu.Lock()
+  defer q.mu.Unlock()
+  return len(q.items)
+}
+
+func (q *DelayQueue) wake() {
+  select {
+  case q.wakeChan <- struct{}{}:
+  default:
+  }
+}
+
+func (q *DelayQueue) run(stopChan, doneChan chan struct{}) {
+  defer close(doneChan)
+  for {
+    q.mu.Lock()
+    select {
+    case <-stopChan:
+      q.mu.Unlock()
+      return
+    default:
+    }
+    var due []*delayItem
+    var timeout <-chan time.Time
+    now := q.clock.Now()
+    for len(q.items) > 0 {
+      item := q.items[0]
+      if d := item.deadline.Sub(now); d > 0 {
+        timeout = q.clock.After(d)
+        break
+      }
+      heap.Pop(&q.items)
+      delete(q.index, item.id)
+      due = append(due, item)
+    }
+    q.mu.Unlock()
+    for _, item := range due {
+      item := item
+      q.executor.Execute(func() {
+        item.f(item.id, item.data)
+      })
+    }
+    select {
+    case <-stopChan:
+      return
+    case <-q.wakeChan:
+    case <-timeout:
+    }
+  }
+}
+
+type delayItem struct {
+  id uint64
+
+  deadline time.Time
+
+  // 在堆中的位置
+  index int
+
+  data interface{}
+
+  f func(uint64, interface{})
+}
+
+type delayHeap []*delayItem
+
+func (h delayHeap) Len() int {
+  return len(h)
+}
+
+func (h delayHeap) Less(i, j int) bool {
+  return h[i].deadline.Before(h[j].deadline)
+}
+
+func (h delayHeap) Swap(i, j int) {
+  h[i], h[j] = h[j], h[i]
+  h[i].index = i
+  h[j].index = j
+}
+
+func (h *delayHeap) Push(x interface{}) {
+  item := x.(*delayItem)
+  item.index = len(*h)
+  *h = append(*h, item)
+}
+
+func (h *delayHeap) Pop() interface{} {
+  old := *h
+  n := len(old)
+  item := old[n-1]
+  old[n-1] = nil
+  item.index = -1
+  *h = old[:n-1]
+  return item
+}
@@ -0,0 +1,78 @@
+package time2
+
+import (
+  "strconv"
+  "sync"
+  "testing"
+  "time"
+)
+
+func TestDelayQueue(t *testing.T) {
+  clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+  q := NewDelayQueue(clock, nil)
+  q.Start()
+  defer q.Stop()
+  delays := []time.Duration{time.Millisecond * 80, time.Millisecond * 10, time.Millisecond * 150, time.Millisecond * 45}
+  var wg sync.WaitGroup
+  wg.Add(len(delays))
+  for i, d := range delays {
+    q.Delay(d, i, expectAfter(t, clock, &wg, d))
+  }
+  id := q.Delay(time.Millisecond*5, nil, func(id uint64, data interface{}) {
+    t.Error("cancelled task fired")
+  })
+  if !q.Cancel(id) || q.Cancel(id) {
+    t.Error("unexpected cancel result")
+  }
+  advanceUntil(t, clock, time.Millisecond*5, time.Millisecond*200, &wg)
+  if q.Len() != 0 {
+    t.Errorf("expected empty queue, got %d", q.Len())
+  }
+}
+
+func benchmarkSchedulers(b *testing.B, f func(*testing.B, Scheduler)) {
+  b.Run("TimingWheel", func(b *testing.B) {
+    tw := NewTimingWheel(60, time.Millisecond*10)
+    tw.Start()
+    defer tw.Stop()
+    f(b, tw)
+  })
+  b.Run("DelayQueue", func(b *testing.B) {
+    q := NewDelayQueue(nil, nil)
+    q.Start()
+    defer q.Stop()
+    f(b, q)
+  })
+}
+
+func BenchmarkDelayCancel(b *testing.B) {
+  fn := func(uint64, interface{}) {}
+  for _, n := range []int{100, 100000} {
+    b.Run(strconv.Itoa(n), func(b *testing.B) {
+      benchmarkSchedulers(b, func(b *testing.B, s Scheduler) {
+        // 先放入n个不会到期的task，测量不同规模下添加/取消的开销
+        for i := 0; i < n; i++ {
+          s.Delay(time.Hour, nil, fn)
+        }
+        b.ResetTimer()
+        for i := 0; i < b.N; i++ {
+          s.Cancel(s.Delay(time.Minute+time.Duration(i%1000)*time.Millisecond, nil, fn))
+        }
+      })
+    })
+  }
+}
+
+func BenchmarkFire(b *testing.B) {
+  benchmarkSchedulers(b, func(b *testing.B, s Scheduler) {
+    var wg sync.WaitGroup
+    wg.Add(b.N)
+    fn := func(uint64, interface{}) {
+      wg.Done()
+    }
+    for i := 0; i < b.N; i++ {
+      s.Delay(time.Millisecond*time.Duration(1+i%50), nil, fn)
+    }
+    wg.Wait()
+  })
+}
@@ -0,0 +1,231 @@
+package time2
+
+import (
+  "fmt"
+  "math"
+  "strconv"
+  "strings"
+  "time"
+  "unicode"
+)
+
+const (
+  Day  = time.Hour * 24
+  Week = Day * 7
+)
+
+// Humanize/RelativeTime的语言
+const (
+  English = iota
+  Chinese
+)
+
+var durationUnits = map[string]time.Duration{
+  "ns": time.Nanosecond, "nanosecond": time.Nanosecond, "nanoseconds": time.Nanosecond, "纳秒": time.Nanosecond,
+  "us": time.Microsecond, "µs": time.Microsecond, "μs": time.Microsecond, "microsecond": time.Microsecond, "microseconds": time.Microsecond, "微秒": time.Microsecond,
+  "ms": time.Millisecond, "millisecond": time.Millisecond, "milliseconds": time.Millisecond, "毫秒": time.Millisecond,
+  "s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second, "秒": time.Second, "秒钟": time.Second,
+  "m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute, "分": time.Minute, "分钟": time.Minute,
+  "h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour, "时": time.Hour, "小时": time.Hour, "个小时": time.Hour,
+  "d": Day, "day": Day, "days": Day, "天": Day, "日": Day,
+  "w": Week, "wk": Week, "wks": Week, "week": Week, "weeks": Week, "周": Week, "星期": Week, "个星期": Week,
+}
+
+// 在time.ParseDuration的基础上支持天（d）和周（w）、英文和中文的单位全称，
+// 数字和单位、各部分之间可以有空格或逗号，
+// 如"1d2h"、"3 weeks"、"1h30m"、"1.5 days"、"2天3小时"、"-1w"
+func ParseDuration(s string) (time.Duration, error) {
+  orig := s
+  s = strings.TrimSpace(s)
+  neg := false
+  if s != "" && (s[0] == '-' || s[0] == '+') {
+    neg = s[0] == '-'
+    s = s[1:]
+  }
+  if s == "0" {
+    return 0, nil
+  }
+  if s == "" {
+    return 0, fmt.Errorf("time2: invalid duration %q", orig)
+  }
+  var total int64
+  for s = trimSeparators(s); s != ""; s = trimSeparators(s) {
+    i := 0
+    for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+      i++
+    }
+    if i == 0 {
+      return 0, fmt.Errorf("time2: invalid duration %q", orig)
+    }
+    num := s[:i]
+    s = strings.TrimLeft(s[i:], " ")
+    j := strings.IndexFunc(s, func(r rune) bool {
+      return !unicode.IsLetter(r)
+    })
+    if j < 0 {
+      j = len(s)
+    }
+    unit, ok := durationUnits[strings.ToLower(s[:j])]
+    if !ok {
+      return 0, fmt.Errorf("time2: unknown unit %q in duration %q", s[:j], orig)
+    }
+    s = s[j:]
+    v, ok := scaleNumber(num, int64(unit))
+    if !ok || v > math.MaxInt64-total {
+      return 0, fmt.Errorf("time2: invalid duration %q", orig)
+    }
+    total += v
+  }
+  d := time.Duration(total)
+  if neg {
+    d = -d
+  }
+  return d, nil
+}
+
+// 计算num（如"1.5"）乘以unit的值，整数部分精确计算，小数部分按unit的精度截断，溢出时返回false
+func scaleNumber(num string, unit int64) (int64, bool) {
+  intPart, fracPart := num, ""
+  if i := strings.IndexByte(num, '.'); i >= 0 {
+    intPart, fracPart = num[:i], num[i+1:]
+  }
+  if intPart == "" && fracPart == "" || strings.IndexByte(fracPart, '.') >= 0 {
+    return 0, false
+  }
+  var v int64
+  for i := 0; i < len(intPart); i++ {
+    if v > (math.MaxInt64-9)/10 {
+      return 0, false
+    }
+    v = v*10 + int64(intPart[i]-'0')
+  }
+  if v > math.MaxInt64/unit {
+    return 0, false
+  }
+  v *= unit
+  // 小数部分逐位累加，每一位的值为unit/10^k，unit不超过一周，不会溢出
+  scale := unit
+  var f int64
+  for i := 0; i < len(fracPart) && scale > 0; i++ {
+    scale /= 10
+    f += int64(fracPart[i]-'0') * scale
+  }
+  if f > math.MaxInt64-v {
+    return 0, false
+  }
+  return v + f, true
+}
+
+func trimSeparators(s string) string {
+  return strings.TrimLeft(s, " ,\t")
+}
+
+// Humanize使用的单位，从大到小
+var humanizeUnits = []struct {
+  d      time.Duration
+  en, zh string
+}{
+  {Day, "day", "天"},
+  {time.Hour, "hour", "小时"},
+  {time.Minute, "minute", "分钟"},
+  {time.Second, "second", "秒"},
+  {time.Millisecond, "millisecond", "毫秒"},
+}
+
+// 把d格式化为易读的形式，最多保留两个最大的单位（舍去更小的部分），
+// 如English时为"2 days 3 hours"，Chinese时为"2天3小时"，
+// 不足1毫秒时为"0 seconds"/"0秒"
+func Humanize(d time.Duration, lang int) string {
+  sign := ""
+  if d < 0 {
+    sign = "-"
+    d = absDuration(d)
+  }
+  parts := make([]string, 0, 2)
+  for _, u := range humanizeUnits {
+    if len(parts) == 2 {
+      break
+    }
+    n := int64(d / u.d)
+    if n == 0 {
+      if len(parts) > 0 {
+        // 只保留相邻的两个单位，如"2天"而不是"2天5秒"
+        break
+      }
+      continue
+    }
+    d -= time.Duration(n) * u.d
+    parts = append(parts, formatUnit(n, u.en, u.zh, lang))
+  }
+  if len(parts) == 0 {
+    return formatUnit(0, "second", "秒", lang)
+  }
+  if lang == Chinese {
+    return sign + strings.Join(parts, "")
+  }
+  return sign + strings.Join(parts, " ")
+}
+
+func formatUnit(n int64, en, zh string, lang int) string {
+  if lang == Chinese {
+    return strconv.FormatInt(n, 10) + zh
+  }
+  if n != 1 {
+    en += "s"
+  }
+  return strconv.FormatInt(n, 10) + " " + en
+}
+
+// RelativeTime使用的单位，月和年按30天和365天近似
+var relativeUnits = []struct {
+  d      time.Duration
+  en, zh string
+}{
+  {Day * 365, "year", "年"},
+  {Day * 30, "month", "个月"},
+  {Day, "day", "天"},
+  {time.Hour, "hour", "小时"},
+  {time.Minute, "minute", "分钟"},
+  {time.Second, "second", "秒"},
+}
+
+// t相对于now的描述，只保留最大的单位，
+// 如English时为"5 minutes ago"/"in 3 days"，Chinese时为"5分钟前"/"3天后"，
+// 相差不到1秒时为"just now"/"刚刚"
+func RelativeTime(t, now time.Time, lang int) string {
+  d := t.Sub(now)
+  future := d > 0
+  d = absDuration(d)
+  for _, u := range relativeUnits {
+    n := int64(d / u.d)
+    if n == 0 {
+      continue
+    }
+    s := formatUnit(n, u.en, u.zh, lang)
+    switch {
+    case lang == Chinese && future:
+      return s + "后"
+    case lang == Chinese:
+      return s + "前"
+    case future:
+      return "in " + s
+    default:
+      return s + " ago"
+    }
+  }
+  if lang == Chinese {
+    return "刚刚"
+  }
+  return "just now"
+}
+
+// math.MinInt64取反会溢出，返回math.MaxInt64（相差1纳秒，不影响Humanize/RelativeTime的结果）
+func absDuration(d time.Duration) time.Duration {
+  switch {
+  case d == math.MinInt64:
+    return math.MaxInt64
+  case d < 0:
+    return -d
+  }
+  return d
+}
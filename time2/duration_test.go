@@ -0,0 +1,58 @@
+package time2
+
+import (
+  "math"
+  "testing"
+  "time"
+)
+
+func TestParseDuration(t *testing.T) {
+  cases := map[string]time.Duration{
+    "1d2h":           Day + time.Hour*2,
+    "3 weeks":        Week * 3,
+    "1h30m":          time.Hour + time.Minute*30,
+    "1.5 days":       Day + time.Hour*12,
+    "2天3小时":          Day*2 + time.Hour*3,
+    "-1w, 2 minutes": -(Week + time.Minute*2),
+    "150ms":          time.Millisecond * 150,
+    "0":              0,
+    // 大数值也精确到纳秒
+    "2562047h47m16.854775807s": math.MaxInt64,
+  }
+  for s, want := range cases {
+    if d, e := ParseDuration(s); e != nil || d != want {
+      t.Errorf("%s: expected %v, got %v, %v", s, want, d, e)
+    }
+  }
+  for _, s := range []string{"", "1", "1y", "h", "1d 2", "2562048h", "1.2.3s"} {
+    if _, e := ParseDuration(s); e == nil {
+      t.Errorf("%q: expected error", s)
+    }
+  }
+}
+
+func TestHumanize(t *testing.T) {
+  d := Day*2 + time.Hour*3 + time.Minute*4
+  if s := Humanize(d, English); s != "2 days 3 hours" {
+    t.Errorf("got %s", s)
+  }
+  if s := Humanize(d, Chinese); s != "2天3小时" {
+    t.Errorf("got %s", s)
+  }
+  if s := Humanize(time.Hour+time.Second, English); s != "1 hour" {
+    t.Errorf("got %s", s)
+  }
+  if s := Humanize(math.MinInt64, English); s != "-106751 days 23 hours" {
+    t.Errorf("got %s", s)
+  }
+  now := time.Now()
+  if s := RelativeTime(now.Add(-time.Minute*5), now, English); s != "5 minutes ago" {
+    t.Errorf("got %s", s)
+  }
+  if s := RelativeTime(now.Add(Day*3+time.Hour), now, Chinese); s != "3天后" {
+    t.Errorf("got %s", s)
+  }
+  if s := RelativeTime(now, now, Chinese); s != "刚刚" {
+    t.Errorf("got %s", s)
+  }
+}
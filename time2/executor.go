@@ -0,0 +1,164 @@
+package time2
+
+import (
+  "sync"
+
+  "github.com/kwf2030/commons/internal/counter"
+)
+
+// 执行TimingWheel中到期的task
+type Executor interface {
+  // 提交f，f被丢弃时返回false
+  Execute(f func()) bool
+
+  // 阻塞直到已提交的f全部执行完
+  Wait()
+}
+
+// 默认Executor，每个f启动一个goroutine执行，不限制数量，也不会recover
+type goExecutor struct {
+  pending counter.Counter
+}
+
+func newGoExecutor() *goExecutor {
+  return &goExecutor{pending: counter.New()}
+}
+
+func (e *goExecutor) Execute(f func()) bool {
+  e.pending.Inc()
+  go func() {
+    defer e.pending.Dec()
+    f()
+  }()
+  return true
+}
+
+func (e *goExecutor) Wait() {
+  e.pending.Wait()
+}
+
+const (
+  // 队列满时阻塞，直到有空位
+  OverflowBlock = iota
+  // 队列满时丢弃
+  OverflowDrop
+  // 队列满时在调用方的goroutine中执行
+  OverflowCallerRuns
+)
+
+// 固定数量worker的goroutine池，
+// f发生panic时会recover并交给panicHandler处理，不会导致进程退出
+type WorkerPool struct {
+  queue chan func()
+
+  // 队列满时的处理方式
+  policy int
+
+  panicHandler func(interface{})
+
+  // 已提交但还没执行完的f
+  pending counter.Counter
+
+  workers sync.WaitGroup
+
+  closed bool
+
+  mu sync.RWMutex
+}
+
+// workers为worker数量，queueSize为等待执行的队列长度，
+// policy为队列满时的处理方式（OverflowBlock/OverflowDrop/OverflowCallerRuns），
+// panicHandler可以为nil（只recover不处理）
+func NewWorkerPool(workers, queueSize, policy int, panicHandler func(interface{})) *WorkerPool {
+  if workers <= 0 || queueSize < 0 {
+    return nil
+  }
+  p := &WorkerPool{
+    queue:        make(chan func(), queueSize),
+    policy:       policy,
+    panicHandler: panicHandler,
+    pending:      counter.New(),
+    mu:           sync.RWMutex{},
+  }
+  p.workers.Add(workers)
+  for i := 0; i < workers; i++ {
+    go p.work()
+  }
+  return p
+}
+
+func (p *WorkerPool) Execute(f func()) bool {
+  if f == nil {
+    return false
+  }
+  p.mu.RLock()
+  if p.closed {
+    p.mu.RUnlock()
+    return false
+  }
+  p.pending.Inc()
+  inline := false
+  switch p.policy {
+  case OverflowDrop:
+    select {
+    case p.queue <- f:
+    default:
+      p.mu.RUnlock()
+      p.pending.Dec()
+      return false
+    }
+  case OverflowCallerRuns:
+    select {
+    case p.queue <- f:
+    default:
+      inline = true
+    }
+  default:
+    p.queue <- f
+  }
+  p.mu.RUnlock()
+  if inline {
+    p.run(f)
+  }
+  return true
+}
+
+// 等待已提交的f全部执行完，Wait期间仍然可以提交
+func (p *WorkerPool) Wait() {
+  p.pending.Wait()
+}
+
+// 不再接受新的f，等待队列中的f全部执行完后退出所有worker
+func (p *WorkerPool) Close() {
+  p.mu.Lock()
+  if p.closed {
+    p.mu.Unlock()
+    return
+  }
+  p.closed = true
+  close(p.queue)
+  p.mu.Unlock()
+  p.workers.Wait()
+}
+
+// 正在排队的f数量
+func (p *WorkerPool) Queued() int {
+  return len(p.queue)
+}
+
+func (p *WorkerPool) work() {
+  defer p.workers.Done()
+  for f := range p.queue {
+    p.run(f)
+  }
+}
+
+func (p *WorkerPool) run(f func()) {
+  defer p.pending.Dec()
+  defer func() {
+    if v := recover(); v != nil && p.panicHandler != nil {
+      p.panicHandler(v)
+    }
+  }()
+  f()
+}
@@ -0,0 +1,147 @@
+package time2
+
+import (
+  "context"
+  "fmt"
+  "sync"
+  "time"
+)
+
+// DelayCtx/AtCtx返回的句柄，用于获取执行结果或取消
+type Handle struct {
+  id uint64
+
+  tw *TimingWheel
+
+  // 传给f的context，Cancel、父context结束或时间轮Stop时都会被取消
+  ctx context.Context
+
+  cancel context.CancelFunc
+
+  f func(context.Context) (interface{}, error)
+
+  done chan struct{}
+
+  result interface{}
+
+  err error
+
+  once sync.Once
+}
+
+func (h *Handle) ID() uint64 {
+  return h.id
+}
+
+// 执行完成或被取消时关闭
+func (h *Handle) Done() <-chan struct{} {
+  return h.done
+}
+
+// 还没完成时返回nil，
+// 完成后返回f返回的error，执行前被取消返回context的error
+func (h *Handle) Err() error {
+  select {
+  case <-h.done:
+    return h.err
+  default:
+    return nil
+  }
+}
+
+// 阻塞直到完成，返回f的返回值
+func (h *Handle) Result() (interface{}, error) {
+  <-h.done
+  return h.result, h.err
+}
+
+// 还没执行时从时间轮中移除，正在执行时取消传给f的context，
+// 已经执行完时什么都不做，返回是否从时间轮中移除了task
+func (h *Handle) Cancel() bool {
+  ok := h.tw.Cancel(h.id)
+  h.cancel()
+  return ok
+}
+
+func (h *Handle) finish(result interface{}, err error) {
+  h.once.Do(func() {
+    h.result, h.err = result, err
+    close(h.done)
+    h.cancel()
+  })
+}
+
+// 延迟delay后执行f，f收到的context在Handle.Cancel、ctx结束或时间轮Stop时被取消，
+// ctx为nil时使用context.Background()
+func (tw *TimingWheel) DelayCtx(ctx context.Context, delay time.Duration, f func(context.Context) (interface{}, error)) *Handle {
+  if delay <= 0 || f == nil {
+    return nil
+  }
+  if ctx == nil {
+    ctx = context.Background()
+  }
+  cctx, cancel := context.WithCancel(ctx)
+  h := &Handle{
+    tw:     tw,
+    ctx:    cctx,
+    cancel: cancel,
+    f:      f,
+    done:   make(chan struct{}),
+  }
+  tw.mu.Lock()
+  task := tw.newTask(delay, h, tw.runHandle)
+  h.id = task.id
+  tw.handles[task.id] = h
+  tw.insert(task)
+  tw.mu.Unlock()
+  if ctx.Done() != nil {
+    go func() {
+      select {
+      case <-ctx.Done():
+        h.Cancel()
+      case <-h.done:
+      }
+    }()
+  }
+  return h
+}
+
+func (tw *TimingWheel) AtCtx(ctx context.Context, t time.Time, f func(context.Context) (interface{}, error)) *Handle {
+  if f == nil {
+    return nil
+  }
+  if now := tw.clock.Now(); t.After(now) {
+    return tw.DelayCtx(ctx, t.Sub(now), f)
+  }
+  return nil
+}
+
+func (tw *TimingWheel) runHandle(id uint64, data interface{}) {
+  h := data.(*Handle)
+  defer func() {
+    tw.mu.Lock()
+    delete(tw.handles, id)
+    tw.mu.Unlock()
+  }()
+  if e := h.ctx.Err(); e != nil {
+    h.finish(nil, e)
+    return
+  }
+  // f发生panic时也要结束，panic继续交给Executor处理
+  defer func() {
+    if v := recover(); v != nil {
+      h.finish(nil, fmt.Errorf("time2: task %d panic: %v", id, v))
+      panic(v)
+    }
+  }()
+  h.finish(h.f(h.ctx))
+}
+
+// 时间轮中还没执行的task被取消时调用（需要持有锁）
+func (tw *TimingWheel) cancelHandle(id uint64) {
+  if h, ok := tw.handles[id]; ok {
+    delete(tw.handles, id)
+    h.cancel()
+    h.finish(nil, h.ctx.Err())
+  }
+}
@@ -0,0 +1,439 @@
+package time2
+
+import (
+  "bufio"
+  "errors"
+  "fmt"
+  "io"
+  "os"
+  "sort"
+  "sync"
+  "time"
+
+  "github.com/kwf2030/commons/base"
+  "github.com/kwf2030/commons/conv"
+)
+
+const (
+  // 重启后已经过期的task立即执行
+  MisfireFireNow = iota
+  // 重启后已经过期的task直接丢弃
+  MisfireSkip
+)
+
+const (
+  journalAdd = iota + 1
+  journalRemove
+)
+
+// 文件中的记录数超过这个值且超过有效记录数的2倍时自动压缩
+const journalCompactThreshold = 1024
+
+// 单条记录的最大长度，读取时长度超过这个值的记录视为文件末尾不完整（损坏），
+// 避免按损坏的长度分配过大的内存
+const journalMaxRecord = 16 << 20
+
+var ErrNoJournal = errors.New("time2: no journal")
+
+// 持久化task的日志文件，每条记录为4字节长度（大端）+gob编码的journalRecord，
+// 只追加写入，添加/执行完/取消都会写一条记录，
+// 重启后根据日志恢复还没执行的task，
+// data需要能被gob编码，非基本类型需要先调用gob.Register注册
+type Journal struct {
+  path string
+
+  f *os.File
+
+  // 当前有效（还没执行或取消）的记录
+  live map[uint64]*journalRecord
+
+  // 文件中的记录数（包括已经失效的）
+  records int
+
+  mu sync.Mutex
+}
+
+type journalRecord struct {
+  Op int
+
+  ID uint64
+
+  // 注册的处理函数名
+  Name string
+
+  // 执行时间（UnixNano）
+  Deadline int64
+
+  Data interface{}
+}
+
+// 打开（不存在则创建）日志文件并读取其中的有效记录，
+// 文件末尾不完整的记录（如写入时进程崩溃）会被截掉
+func OpenJournal(path string) (*Journal, error) {
+  if path == "" {
+    return nil, base.ErrInvalidArgument
+  }
+  f, e := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+  if e != nil {
+    return nil, e
+  }
+  j := &Journal{
+    path: path,
+    f:    f,
+    live: make(map[uint64]*journalRecord, 64),
+    mu:   sync.Mutex{},
+  }
+  offset, e := j.load()
+  if e != nil {
+    f.Close()
+    return nil, e
+  }
+  if e = f.Truncate(offset); e != nil {
+    f.Close()
+    return nil, e
+  }
+  if _, e = f.Seek(offset, io.SeekStart); e != nil {
+    f.Close()
+    return nil, e
+  }
+  return j, nil
+}
+
+// 读取所有完整的记录，返回最后一条完整记录的结束位置
+func (j *Journal) load() (int64, error) {
+  r := bufio.NewReader(j.f)
+  var offset int64
+  head := make([]byte, 4)
+  for {
+    if _, e := io.ReadFull(r, head); e != nil {
+      break
+    }
+    n := conv.BytesToUint32(head)
+    if n == 0 || n > journalMaxRecord {
+      break
+    }
+    data := make([]byte, n)
+    if _, e := io.ReadFull(r, data); e != nil {
+      break
+    }
+    rec := &journalRecord{}
+    if e := conv.FromGob(data, rec); e != nil {
+      return 0, fmt.Errorf("time2: corrupted journal %s at offset %d: %v", j.path, offset, e)
+    }
+    offset += int64(len(head) + len(data))
+    j.records++
+    switch rec.Op {
+    case journalAdd:
+      j.live[rec.ID] = rec
+    case journalRemove:
+      delete(j.live, rec.ID)
+    }
+  }
+  return offset, nil
+}
+
+func (j *Journal) add(id uint64, name string, deadline time.Time, data interface{}) error {
+  j.mu.Lock()
+  defer j.mu.Unlock()
+  rec := &journalRecord{
+    Op:       journalAdd,
+    ID:       id,
+    Name:     name,
+    Deadline: deadline.UnixNano(),
+    Data:     data,
+  }
+  if e := j.write(rec); e != nil {
+    return e
+  }
+  j.live[id] = rec
+  return nil
+}
+
+func (j *Journal) remove(id uint64) error {
+  j.mu.Lock()
+  defer j.mu.Unlock()
+  if _, ok := j.live[id]; !ok {
+    return nil
+  }
+  if e := j.write(&journalRecord{Op: journalRemove, ID: id}); e != nil {
+    return e
+  }
+  delete(j.live, id)
+  if j.records >= journalCompactThreshold && j.records > len(j.live)*2 {
+    return j.compact()
+  }
+  return nil
+}
+
+// 修改有效记录的执行时间，没有变化时不写
+func (j *Journal) reset(id uint64, deadline time.Time) error {
+  j.mu.Lock()
+  defer j.mu.Unlock()
+  rec, ok := j.live[id]
+  if !ok || rec.Deadline == deadline.UnixNano() {
+    return nil
+  }
+  rec2 := *rec
+  rec2.Deadline = deadline.UnixNano()
+  if e := j.write(&rec2); e != nil {
+    return e
+  }
+  j.live[id] = &rec2
+  return nil
+}
+
+// 有效记录中task id最大的generation
+func (j *Journal) maxGen() uint64 {
+  j.mu.Lock()
+  defer j.mu.Unlock()
+  var ret uint64
+  for id := range j.live {
+    if gen := id >> seqBits; gen > ret {
+      ret = gen
+    }
+  }
+  return ret
+}
+
+// 有效记录，按执行时间排序
+func (j *Journal) pending() []*journalRecord {
+  j.mu.Lock()
+  defer j.mu.Unlock()
+  ret := make([]*journalRecord, 0, len(j.live))
+  for _, rec := range j.live {
+    ret = append(ret, rec)
+  }
+  sort.Slice(ret, func(a, b int) bool {
+    return ret[a].Deadline < ret[b].Deadline
+  })
+  return ret
+}
+
+func (j *Journal) write(rec *journalRecord) error {
+  if j.f == nil {
+    return os.ErrClosed
+  }
+  b, e := encodeRecord(rec)
+  if e != nil {
+    return e
+  }
+  if _, e = j.f.Write(b); e != nil {
+    return e
+  }
+  j.records++
+  return nil
+}
+
+func encodeRecord(rec *journalRecord) ([]byte, error) {
+  data, e := conv.ToGob(rec)
+  if e != nil {
+    return nil, e
+  }
+  if len(data) > journalMaxRecord {
+    return nil, fmt.Errorf("time2: journal record too large (%d bytes)", len(data))
+  }
+  return append(conv.Uint32ToBytes(uint32(len(data))), data...), nil
+}
+
+// 有效记录数
+func (j *Journal) Len() int {
+  j.mu.Lock()
+  defer j.mu.Unlock()
+  return len(j.live)
+}
+
+// 把有效记录写到新文件后替换原文件
+func (j *Journal) Compact() error {
+  j.mu.Lock()
+  defer j.mu.Unlock()
+  return j.compact()
+}
+
+func (j *Journal) compact() error {
+  if j.f == nil {
+    return os.ErrClosed
+  }
+  tmp := j.path + ".tmp"
+  f, e := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+  if e != nil {
+    return e
+  }
+  w := bufio.NewWriter(f)
+  for _, rec := range j.live {
+    b, e := encodeRecord(rec)
+    if e == nil {
+      _, e = w.Write(b)
+    }
+    if e != nil {
+      f.Close()
+      os.Remove(tmp)
+      return e
+    }
+  }
+  if e = w.Flush(); e == nil {
+    e = f.Sync()
+  }
+  if e != nil {
+    f.Close()
+    os.Remove(tmp)
+    return e
+  }
+  f.Close()
+  if e = os.Rename(tmp, j.path); e != nil {
+    // 原文件不受影响，继续使用
+    os.Remove(tmp)
+    return e
+  }
+  // 重命名之后j.f指向的是已经被替换的旧文件，需要重新打开
+  nf, e := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0644)
+  if e != nil {
+    // 新文件已经包含了所有有效记录，但打不开时只能关闭，之后的写入返回os.ErrClosed
+    j.f.Close()
+    j.f = nil
+    return e
+  }
+  j.f.Close()
+  j.f = nf
+  j.records = len(j.live)
+  return nil
+}
+
+// 把写入的记录刷到磁盘
+func (j *Journal) Sync() error {
+  j.mu.Lock()
+  defer j.mu.Unlock()
+  if j.f == nil {
+    return os.ErrClosed
+  }
+  return j.f.Sync()
+}
+
+func (j *Journal) Close() error {
+  j.mu.Lock()
+  defer j.mu.Unlock()
+  if j.f == nil {
+    return nil
+  }
+  e := j.f.Sync()
+  if e2 := j.f.Close(); e == nil {
+    e = e2
+  }
+  j.f = nil
+  return e
+}
+
+// 启用持久化，policy为重启后已经过期的task的处理方式（MisfireFireNow/MisfireSkip），
+// 需要持久化的task通过Register注册处理函数，DelayDurable/AtDurable添加，
+// Journal中的task在第一次Start时恢复
+func WithJournal(j *Journal, policy int) Option {
+  return func(tw *TimingWheel) {
+    if j == nil {
+      return
+    }
+    tw.journal = j
+    tw.misfire = policy
+    // 新的task id不能与日志中的重复
+    if gen := j.maxGen(); gen >= tw.gen {
+      tw.gen = gen
+      tw.nextGen()
+    }
+  }
+}
+
+// 注册可持久化task的处理函数，需要在Start之前注册，
+// 恢复时找不到处理函数的task会保留在Journal中
+func (tw *TimingWheel) Register(name string, f func(uint64, interface{})) {
+  if name == "" || f == nil {
+    return
+  }
+  tw.mu.Lock()
+  defer tw.mu.Unlock()
+  tw.handlers[name] = f
+}
+
+// 延迟delay后执行name对应的处理函数，在执行完或被取消之前进程重启也不会丢失，
+// 处理函数执行过程中进程退出的，重启后会再执行一次
+func (tw *TimingWheel) DelayDurable(delay time.Duration, name string, data interface{}) (uint64, error) {
+  if delay <= 0 {
+    return 0, base.ErrInvalidArgument
+  }
+  if tw.journal == nil {
+    return 0, ErrNoJournal
+  }
+  tw.mu.Lock()
+  defer tw.mu.Unlock()
+  f, ok := tw.handlers[name]
+  if !ok {
+    return 0, fmt.Errorf("time2: handler %s not registered", name)
+  }
+  task := tw.newTask(delay, data, tw.durable(f))
+  // 先写日志再放到时间轮中，写日志失败时不会执行
+  if e := tw.journal.add(task.id, name, task.deadline, data); e != nil {
+    return 0, e
+  }
+  tw.insert(task)
+  return task.id, nil
+}
+
+func (tw *TimingWheel) AtDurable(t time.Time, name string, data interface{}) (uint64, error) {
+  if now := tw.clock.Now(); t.After(now) {
+    return tw.DelayDurable(t.Sub(now), name, data)
+  }
+  return 0, base.ErrInvalidArgument
+}
+
+// 执行完后从日志中删除，与Cancel一样在锁内写日志
+func (tw *TimingWheel) durable(f func(uint64, interface{})) func(uint64, interface{}) {
+  return func(id uint64, data interface{}) {
+    f(id, data)
+    tw.mu.Lock()
+    tw.journalError(id, tw.journal.remove(id))
+    tw.mu.Unlock()
+  }
+}
+
+// 暂停或停止后重新开始计时时，task的执行时间都推迟了（见startTicking），
+// 持久化的task需要同步修改日志中的执行时间，否则重启后会提前执行（或被当作已经过期）（需要持有锁）
+func (tw *TimingWheel) syncJournal() {
+  if tw.journal == nil {
+    return
+  }
+  for _, t := range tw.tasks {
+    tw.journalError(t.id, tw.journal.reset(t.id, t.deadline))
+  }
+}
+
+// 通知Observer写日志失败（需要持有锁），e为nil时什么都不做
+func (tw *TimingWheel) journalError(id uint64, e error) {
+  if e == nil {
+    return
+  }
+  if o, ok := tw.observer.(JournalObserver); ok {
+    o.OnJournalError(id, e)
+  }
+}
+
+// 恢复日志中的task（需要持有锁）
+func (tw *TimingWheel) replay() {
+  now := tw.clock.Now()
+  for _, rec := range tw.journal.pending() {
+    if _, ok := tw.tasks[rec.ID]; ok {
+      continue
+    }
+    f, ok := tw.handlers[rec.Name]
+    if !ok {
+      continue
+    }
+    delay := time.Unix(0, rec.Deadline).Sub(now)
+    if delay <= 0 {
+      if tw.misfire == MisfireSkip {
+        tw.journalError(rec.ID, tw.journal.remove(rec.ID))
+        continue
+      }
+      delay = 0
+    }
+    task := tw.newTask(delay, rec.Data, tw.durable(f))
+    task.id = rec.ID
+    tw.insert(task)
+  }
+}
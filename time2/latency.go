@@ -0,0 +1,279 @@
+package time2
+
+import (
+  "encoding/json"
+  "io"
+  "math"
+  "math/bits"
+  "strconv"
+  "sync/atomic"
+  "time"
+
+  "github.com/kwf2030/commons/base"
+)
+
+// 延迟直方图（类似HdrHistogram的对数-线性分桶），记录纳秒级的时长，
+// 相对误差由有效数字位数决定，内存固定，可以并发调用Record，相同精度的直方图可以合并
+type LatencyHistogram struct {
+  // 64位原子操作的字段放在最前面，保证32位平台上的对齐
+  count uint64
+
+  // 纳秒
+  sum int64
+  min int64
+  max int64
+
+  digits int
+
+  // 每组的有效位数，小于1<<p的值每个值一个桶，之后每组（值翻倍）1<<(p-1)个桶
+  p uint
+
+  counts []uint64
+}
+
+// digits为有效数字位数（1~3），对应的相对误差分别小于10%、1%、0.1%，
+// 内存占用分别约为8KB、60KB、440KB
+func NewLatencyHistogram(digits int) (*LatencyHistogram, error) {
+  if digits < 1 || digits > 3 {
+    return nil, base.ErrInvalidArgument
+  }
+  // 2^-(p-1)不超过10^-digits
+  p := uint(math.Ceil(float64(digits)*math.Log2(10))) + 1
+  h := &LatencyHistogram{digits: digits, p: p, min: math.MaxInt64}
+  h.counts = make([]uint64, h.index(math.MaxInt64)+1)
+  return h, nil
+}
+
+func (h *LatencyHistogram) index(v int64) int {
+  sub := int64(1) << h.p
+  if v < sub {
+    return int(v)
+  }
+  shift := uint(bits.Len64(uint64(v))) - h.p
+  return int(sub) + int(shift-1)<<(h.p-1) + int(v>>shift-sub/2)
+}
+
+// 桶i中的最小值和最大值
+func (h *LatencyHistogram) bucket(i int) (int64, int64) {
+  sub := 1 << h.p
+  if i < sub {
+    return int64(i), int64(i)
+  }
+  half := sub / 2
+  shift := uint((i-sub)/half) + 1
+  lo := int64((i-sub)%half+half) << shift
+  return lo, lo + int64(1)<<shift - 1
+}
+
+// 记录一个时长，负数记为0
+func (h *LatencyHistogram) Record(d time.Duration) {
+  v := int64(d)
+  if v < 0 {
+    v = 0
+  }
+  atomic.AddUint64(&h.counts[h.index(v)], 1)
+  atomic.AddUint64(&h.count, 1)
+  atomic.AddInt64(&h.sum, v)
+  for {
+    old := atomic.LoadInt64(&h.min)
+    if v >= old || atomic.CompareAndSwapInt64(&h.min, old, v) {
+      break
+    }
+  }
+  for {
+    old := atomic.LoadInt64(&h.max)
+    if v <= old || atomic.CompareAndSwapInt64(&h.max, old, v) {
+      break
+    }
+  }
+}
+
+// 记录f的执行时间（使用RealClock）
+func (h *LatencyHistogram) Time(f func()) time.Duration {
+  start := time.Now()
+  f()
+  d := time.Since(start)
+  h.Record(d)
+  return d
+}
+
+func (h *LatencyHistogram) Count() uint64 {
+  return atomic.LoadUint64(&h.count)
+}
+
+func (h *LatencyHistogram) Min() time.Duration {
+  if h.Count() == 0 {
+    return 0
+  }
+  return time.Duration(atomic.LoadInt64(&h.min))
+}
+
+func (h *LatencyHistogram) Max() time.Duration {
+  return time.Duration(atomic.LoadInt64(&h.max))
+}
+
+func (h *LatencyHistogram) Mean() time.Duration {
+  n := h.Count()
+  if n == 0 {
+    return 0
+  }
+  return time.Duration(atomic.LoadInt64(&h.sum) / int64(n))
+}
+
+// 第q百分位数（0~100），返回所在桶的上限（不超过Max），没有数据时返回0
+func (h *LatencyHistogram) Percentile(q float64) time.Duration {
+  n := h.Count()
+  if n == 0 {
+    return 0
+  }
+  if q > 100 {
+    q = 100
+  }
+  rank := uint64(math.Ceil(q / 100 * float64(n)))
+  if rank == 0 {
+    rank = 1
+  }
+  max := atomic.LoadInt64(&h.max)
+  var c uint64
+  for i := range h.counts {
+    c += atomic.LoadUint64(&h.counts[i])
+    if c >= rank {
+      _, hi := h.bucket(i)
+      if hi > max {
+        hi = max
+      }
+      return time.Duration(hi)
+    }
+  }
+  return time.Duration(max)
+}
+
+// 把o的数据合并到h，有效数字位数不同时返回错误
+func (h *LatencyHistogram) Merge(o *LatencyHistogram) error {
+  if h.digits != o.digits {
+    return base.ErrInvalidArgument
+  }
+  for i := range o.counts {
+    if c := atomic.LoadUint64(&o.counts[i]); c > 0 {
+      atomic.AddUint64(&h.counts[i], c)
+    }
+  }
+  h.mergeStats(atomic.LoadUint64(&o.count), atomic.LoadInt64(&o.sum), atomic.LoadInt64(&o.min), atomic.LoadInt64(&o.max))
+  return nil
+}
+
+func (h *LatencyHistogram) mergeStats(count uint64, sum, min, max int64) {
+  if count == 0 {
+    return
+  }
+  atomic.AddUint64(&h.count, count)
+  atomic.AddInt64(&h.sum, sum)
+  for {
+    old := atomic.LoadInt64(&h.min)
+    if min >= old || atomic.CompareAndSwapInt64(&h.min, old, min) {
+      break
+    }
+  }
+  for {
+    old := atomic.LoadInt64(&h.max)
+    if max <= old || atomic.CompareAndSwapInt64(&h.max, old, max) {
+      break
+    }
+  }
+}
+
+// 清空数据，与Record并发调用时可能丢失部分数据
+func (h *LatencyHistogram) Reset() {
+  for i := range h.counts {
+    atomic.StoreUint64(&h.counts[i], 0)
+  }
+  atomic.StoreUint64(&h.count, 0)
+  atomic.StoreInt64(&h.sum, 0)
+  atomic.StoreInt64(&h.min, math.MaxInt64)
+  atomic.StoreInt64(&h.max, 0)
+}
+
+// WriteText和MarshalJSON输出的百分位
+var LatencyPercentiles = []float64{50, 75, 90, 95, 99, 99.9}
+
+// 以文本格式输出统计和百分位，如：
+//   count=1000 min=1ms mean=5ms max=120ms
+//   p50=4ms p75=6ms p90=9ms p95=12ms p99=50ms p99.9=120ms
+func (h *LatencyHistogram) WriteText(w io.Writer) error {
+  ew := &errWriter{w: w}
+  ew.printf("count=%d min=%s mean=%s max=%s\n", h.Count(), h.Min(), h.Mean(), h.Max())
+  for i, q := range LatencyPercentiles {
+    if i > 0 {
+      ew.printf(" ")
+    }
+    ew.printf("p%g=%s", q, h.Percentile(q))
+  }
+  ew.printf("\n")
+  return ew.e
+}
+
+type latencyJSON struct {
+  Digits int `json:"digits"`
+
+  Count uint64 `json:"count"`
+
+  // 以下都是纳秒
+  Sum  int64 `json:"sum"`
+  Min  int64 `json:"min"`
+  Max  int64 `json:"max"`
+  Mean int64 `json:"mean"`
+
+  // key为"p50"等
+  Percentiles map[string]int64 `json:"percentiles"`
+
+  // 非空的桶，每个元素为[桶的最小值, 数量]
+  Buckets [][2]int64 `json:"buckets"`
+}
+
+// 输出统计、百分位和非空的桶，UnmarshalJSON可以还原（用于跨进程合并）
+func (h *LatencyHistogram) MarshalJSON() ([]byte, error) {
+  v := latencyJSON{
+    Digits:      h.digits,
+    Count:       h.Count(),
+    Sum:         atomic.LoadInt64(&h.sum),
+    Min:         int64(h.Min()),
+    Max:         int64(h.Max()),
+    Mean:        int64(h.Mean()),
+    Percentiles: make(map[string]int64, len(LatencyPercentiles)),
+    Buckets:     make([][2]int64, 0, 16),
+  }
+  for _, q := range LatencyPercentiles {
+    v.Percentiles["p"+strconv.FormatFloat(q, 'g', -1, 64)] = int64(h.Percentile(q))
+  }
+  for i := range h.counts {
+    if c := atomic.LoadUint64(&h.counts[i]); c > 0 {
+      lo, _ := h.bucket(i)
+      v.Buckets = append(v.Buckets, [2]int64{lo, int64(c)})
+    }
+  }
+  return json.Marshal(v)
+}
+
+// 还原MarshalJSON的输出，h原有的数据会被清空
+func (h *LatencyHistogram) UnmarshalJSON(data []byte) error {
+  var v latencyJSON
+  if e := json.Unmarshal(data, &v); e != nil {
+    return e
+  }
+  n, e := NewLatencyHistogram(v.Digits)
+  if e != nil {
+    return e
+  }
+  for _, b := range v.Buckets {
+    if b[0] < 0 || b[1] < 0 {
+      return base.ErrInvalidArgument
+    }
+    n.counts[n.index(b[0])] += uint64(b[1])
+  }
+  if v.Count > 0 {
+    n.mergeStats(v.Count, v.Sum, v.Min, v.Max)
+  }
+  h.digits, h.p, h.counts = n.digits, n.p, n.counts
+  h.count, h.sum, h.min, h.max = n.count, n.sum, n.min, n.max
+  return nil
+}
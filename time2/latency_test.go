@@ -0,0 +1,54 @@
+package time2
+
+import (
+  "strings"
+  "testing"
+  "time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+  if _, e := NewLatencyHistogram(4); e == nil {
+    t.Error("expected error")
+  }
+  h, _ := NewLatencyHistogram(2)
+  for i := 0; i < len(h.counts); i++ {
+    lo, hi := h.bucket(i)
+    if h.index(lo) != i || h.index(hi) != i {
+      t.Fatalf("bucket %d: [%d, %d]", i, lo, hi)
+    }
+  }
+  for i := 1; i <= 1000; i++ {
+    h.Record(time.Duration(i) * time.Microsecond)
+  }
+  if h.Count() != 1000 || h.Min() != time.Microsecond || h.Max() != time.Millisecond {
+    t.Errorf("got %d, %s, %s", h.Count(), h.Min(), h.Max())
+  }
+  for _, q := range []float64{50, 90, 99} {
+    want := time.Duration(q*10) * time.Microsecond
+    if got := h.Percentile(q); got < want || float64(got-want) > float64(want)*0.01 {
+      t.Errorf("p%g: got %s", q, got)
+    }
+  }
+
+  o, _ := NewLatencyHistogram(2)
+  o.Record(time.Second)
+  if e := h.Merge(o); e != nil || h.Count() != 1001 || h.Max() != time.Second || h.Percentile(100) != time.Second {
+    t.Errorf("got %v, %d, %s", e, h.Count(), h.Max())
+  }
+  data, e := h.MarshalJSON()
+  if e != nil {
+    t.Fatal(e)
+  }
+  var r LatencyHistogram
+  if e = r.UnmarshalJSON(data); e != nil || r.Count() != 1001 || r.Percentile(50) != h.Percentile(50) || r.Mean() != h.Mean() {
+    t.Errorf("got %v, %d", e, r.Count())
+  }
+  var b strings.Builder
+  if e = h.WriteText(&b); e != nil || !strings.Contains(b.String(), "count=1001 min=1µs") || !strings.Contains(b.String(), "p99.9=") {
+    t.Errorf("got %q", b.String())
+  }
+  h.Reset()
+  if h.Count() != 0 || h.Percentile(50) != 0 {
+    t.Error("not reset")
+  }
+}
@@ -0,0 +1,119 @@
+package time2
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+)
+
+var (
+  // LoadLocation加载过或RegisterLocation注册的时区，key为名字
+  locations = map[string]*time.Location{
+    "UTC": time.UTC,
+  }
+
+  locationsMu sync.RWMutex
+)
+
+// 按名字加载时区，依次尝试：
+// 已注册/加载过的时区、固定偏移（见ParseOffset）、time.LoadLocation，
+// 系统没有时区数据（如精简的容器镜像）时，可以用go build -tags timetzdata把时区数据（约450KB）编译到程序中，
+// name为""或"UTC"时返回time.UTC，为"Local"时返回time.Local
+func LoadLocation(name string) (*time.Location, error) {
+  switch name {
+  case "", "UTC":
+    return time.UTC, nil
+  case "Local":
+    return time.Local, nil
+  }
+  locationsMu.RLock()
+  loc, ok := locations[name]
+  locationsMu.RUnlock()
+  if ok {
+    return loc, nil
+  }
+  loc, e := ParseOffset(name)
+  if e != nil {
+    if loc, e = time.LoadLocation(name); e != nil {
+      return nil, e
+    }
+  }
+  RegisterLocation(name, loc)
+  return loc, nil
+}
+
+// 与LoadLocation相同，加载失败时panic，用于初始化包级别的变量
+func MustLoadLocation(name string) *time.Location {
+  loc, e := LoadLocation(name)
+  if e != nil {
+    panic(e)
+  }
+  return loc
+}
+
+// 注册时区（或别名），之后LoadLocation(name)直接返回loc
+func RegisterLocation(name string, loc *time.Location) {
+  if name == "" || loc == nil {
+    return
+  }
+  locationsMu.Lock()
+  defer locationsMu.Unlock()
+  locations[name] = loc
+}
+
+// 解析固定偏移的时区，支持"+08:00"、"+0800"、"+08"、"-05:30"、"Z"，
+// 以及带"UTC"/"GMT"前缀的形式（如"UTC+8"、"GMT-05:30"），
+// 返回的时区名字为规范化的偏移（如"+08:00"）
+func ParseOffset(s string) (*time.Location, error) {
+  orig := s
+  s = strings.TrimSpace(s)
+  if s == "Z" {
+    return time.UTC, nil
+  }
+  for _, prefix := range []string{"UTC", "GMT"} {
+    if strings.HasPrefix(strings.ToUpper(s), prefix) {
+      s = s[len(prefix):]
+      break
+    }
+  }
+  if len(s) < 2 || s[0] != '+' && s[0] != '-' {
+    return nil, fmt.Errorf("time2: invalid offset %q", orig)
+  }
+  sign := 1
+  if s[0] == '-' {
+    sign = -1
+  }
+  s = s[1:]
+  var hh, mm string
+  switch {
+  case strings.Contains(s, ":"):
+    i := strings.IndexByte(s, ':')
+    hh, mm = s[:i], s[i+1:]
+  case len(s) == 4:
+    hh, mm = s[:2], s[2:]
+  default:
+    hh, mm = s, "0"
+  }
+  h, e1 := strconv.Atoi(hh)
+  m, e2 := strconv.Atoi(mm)
+  if e1 != nil || e2 != nil || len(hh) > 2 || len(mm) > 2 || h > 14 || m >= 60 {
+    return nil, fmt.Errorf("time2: invalid offset %q", orig)
+  }
+  offset := sign * (h*3600 + m*60)
+  name := fmt.Sprintf("%c%02d:%02d", "+-"[(1-sign)/2], h, m)
+  return time.FixedZone(name, offset), nil
+}
+
+// loc中的当前时间，loc为nil时为time.Local
+func Now(loc *time.Location) time.Time {
+  if loc == nil {
+    loc = time.Local
+  }
+  return time.Now().In(loc)
+}
+
+func NowStr(loc *time.Location, layout string) string {
+  return Now(loc).Format(layout)
+}
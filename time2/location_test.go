@@ -0,0 +1,57 @@
+package time2
+
+import (
+  "testing"
+  "time"
+)
+
+func TestLoadLocation(t *testing.T) {
+  cases := map[string]int{
+    "+08:00":     8 * 3600,
+    "-0530":      -(5*3600 + 1800),
+    "UTC+8":      8 * 3600,
+    "GMT-05":     -5 * 3600,
+    "Z":          0,
+    "":           0,
+    "Asia/Tokyo": 9 * 3600,
+  }
+  now := time.Date(2020, 8, 13, 0, 0, 0, 0, time.UTC)
+  for name, offset := range cases {
+    loc, e := LoadLocation(name)
+    if e != nil {
+      t.Errorf("%s: %v", name, e)
+      continue
+    }
+    if _, v := now.In(loc).Zone(); v != offset {
+      t.Errorf("%s: expected offset %d, got %d", name, offset, v)
+    }
+  }
+  for _, name := range []string{"+25:00", "+08:60", "8", "Nowhere/City"} {
+    if _, e := LoadLocation(name); e == nil {
+      t.Errorf("%s: expected error", name)
+    }
+  }
+  RegisterLocation("office", TimeZoneSH)
+  if loc, e := LoadLocation("office"); e != nil || loc != TimeZoneSH {
+    t.Errorf("unexpected location: %v, %v", loc, e)
+  }
+  if TimeZoneSH == nil {
+    t.Error("TimeZoneSH is nil")
+  }
+
+  // 有夏令时和历史偏移的时区（需要系统的时区数据或-tags timetzdata）
+  ny, e := LoadLocation("America/New_York")
+  if e != nil {
+    t.Fatal(e)
+  }
+  if _, v := time.Date(2020, 1, 1, 0, 0, 0, 0, ny).Zone(); v != -5*3600 {
+    t.Errorf("New York winter: got %d", v)
+  }
+  if _, v := time.Date(2020, 7, 1, 0, 0, 0, 0, ny).Zone(); v != -4*3600 {
+    t.Errorf("New York summer: got %d", v)
+  }
+  // 1986~1991年中国实行过夏令时
+  if _, v := time.Date(1988, 7, 1, 0, 0, 0, 0, TimeZoneSH).Zone(); v != 9*3600 {
+    t.Errorf("Shanghai 1988 summer: got %d", v)
+  }
+}
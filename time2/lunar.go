@@ -0,0 +1,336 @@
+package time2
+
+import (
+  "math"
+  "time"
+
+  "github.com/kwf2030/commons/base"
+)
+
+// 农历（阴历）日期，支持1900年正月初一（1900-01-31）到2100年腊月
+type LunarDate struct {
+  Year int
+
+  Month int
+
+  Day int
+
+  // 是否闰月
+  Leap bool
+}
+
+const (
+  lunarMinYear = 1900
+  lunarMaxYear = 2100
+)
+
+var (
+  // 1900年正月初一
+  lunarBase = time.Date(1900, 1, 31, 0, 0, 0, 0, time.UTC)
+
+  // 1900~2100年每年的月份信息，
+  // 低4位为闰月月份（0表示没有闰月），
+  // 第4~15位依次为12月~1月是否为大月（30天，否则为29天），
+  // 第16位为闰月是否为大月
+  lunarInfo = [...]int{
+    0x04bd8, 0x04ae0, 0x0a570, 0x054d5, 0x0d260, 0x0d950, 0x16554, 0x056a0, 0x09ad0, 0x055d2, // 1900
+    0x04ae0, 0x0a5b6, 0x0a4d0, 0x0d250, 0x1d255, 0x0b540, 0x0d6a0, 0x0ada2, 0x095b0, 0x14977, // 1910
+    0x04970, 0x0a4b0, 0x0b4b5, 0x06a50, 0x06d40, 0x1ab54, 0x02b60, 0x09570, 0x052f2, 0x04970, // 1920
+    0x06566, 0x0d4a0, 0x0ea50, 0x16a95, 0x05ad0, 0x02b60, 0x186e3, 0x092e0, 0x1c8d7, 0x0c950, // 1930
+    0x0d4a0, 0x1d8a6, 0x0b550, 0x056a0, 0x1a5b4, 0x025d0, 0x092d0, 0x0d2b2, 0x0a950, 0x0b557, // 1940
+    0x06ca0, 0x0b550, 0x15355, 0x04da0, 0x0a5b0, 0x14573, 0x052b0, 0x0a9a8, 0x0e950, 0x06aa0, // 1950
+    0x0aea6, 0x0ab50, 0x04b60, 0x0aae4, 0x0a570, 0x05260, 0x0f263, 0x0d950, 0x05b57, 0x056a0, // 1960
+    0x096d0, 0x04dd5, 0x04ad0, 0x0a4d0, 0x0d4d4, 0x0d250, 0x0d558, 0x0b540, 0x0b6a0, 0x195a6, // 1970
+    0x095b0, 0x049b0, 0x0a974, 0x0a4b0, 0x0b27a, 0x06a50, 0x06d40, 0x0af46, 0x0ab60, 0x09570, // 1980
+    0x04af5, 0x04970, 0x064b0, 0x074a3, 0x0ea50, 0x06b58, 0x05ac0, 0x0ab60, 0x096d5, 0x092e0, // 1990
+    0x0c960, 0x0d954, 0x0d4a0, 0x0da50, 0x07552, 0x056a0, 0x0abb7, 0x025d0, 0x092d0, 0x0cab5, // 2000
+    0x0a950, 0x0b4a0, 0x0baa4, 0x0ad50, 0x055d9, 0x04ba0, 0x0a5b0, 0x15176, 0x052b0, 0x0a930, // 2010
+    0x07954, 0x06aa0, 0x0ad50, 0x05b52, 0x04b60, 0x0a6e6, 0x0a4e0, 0x0d260, 0x0ea65, 0x0d530, // 2020
+    0x05aa0, 0x076a3, 0x096d0, 0x04afb, 0x04ad0, 0x0a4d0, 0x1d0b6, 0x0d250, 0x0d520, 0x0dd45, // 2030
+    0x0b5a0, 0x056d0, 0x055b2, 0x049b0, 0x0a577, 0x0a4b0, 0x0aa50, 0x1b255, 0x06d20, 0x0ada0, // 2040
+    0x14b63, 0x09370, 0x049f8, 0x04970, 0x064b0, 0x168a6, 0x0ea50, 0x06b20, 0x1a6c4, 0x0aae0, // 2050
+    0x092e0, 0x0d2e3, 0x0c960, 0x0d557, 0x0d4a0, 0x0da50, 0x05d55, 0x056a0, 0x0a6d0, 0x055d4, // 2060
+    0x052d0, 0x0a9b8, 0x0a950, 0x0b4a0, 0x0b6a6, 0x0ad50, 0x055a0, 0x0aba4, 0x0a5b0, 0x052b0, // 2070
+    0x0b273, 0x06930, 0x07337, 0x06aa0, 0x0ad50, 0x14b55, 0x04b60, 0x0a570, 0x054e4, 0x0d160, // 2080
+    0x0e968, 0x0d520, 0x0daa0, 0x16aa6, 0x056d0, 0x04ae0, 0x0a9d4, 0x0a2d0, 0x0d150, 0x0f252, // 2090
+    0x0d520, // 2100
+  }
+
+  tianGan = [...]string{"甲", "乙", "丙", "丁", "戊", "己", "庚", "辛", "壬", "癸"}
+
+  diZhi = [...]string{"子", "丑", "寅", "卯", "辰", "巳", "午", "未", "申", "酉", "戌", "亥"}
+
+  zodiacs = [...]string{"鼠", "牛", "虎", "兔", "龙", "蛇", "马", "羊", "猴", "鸡", "狗", "猪"}
+
+  lunarMonthNames = [...]string{"正", "二", "三", "四", "五", "六", "七", "八", "九", "十", "冬", "腊"}
+
+  lunarDayNames = [...]string{"初", "十", "廿", "三"}
+
+  chineseDigits = [...]string{"〇", "一", "二", "三", "四", "五", "六", "七", "八", "九", "十"}
+)
+
+// year的闰月月份，没有闰月或超出范围时返回0
+func LeapMonth(year int) int {
+  if year < lunarMinYear || year > lunarMaxYear {
+    return 0
+  }
+  return lunarInfo[year-lunarMinYear] & 0xf
+}
+
+// 农历year年month月（leap为是否闰月）的天数，不存在时返回0
+func LunarMonthDays(year, month int, leap bool) int {
+  if year < lunarMinYear || year > lunarMaxYear || month < 1 || month > 12 {
+    return 0
+  }
+  info := lunarInfo[year-lunarMinYear]
+  if leap {
+    if info&0xf != month {
+      return 0
+    }
+    if info&0x10000 != 0 {
+      return 30
+    }
+    return 29
+  }
+  if info&(0x10000>>uint(month)) != 0 {
+    return 30
+  }
+  return 29
+}
+
+// 农历year年的天数，超出范围时返回0
+func LunarYearDays(year int) int {
+  if year < lunarMinYear || year > lunarMaxYear {
+    return 0
+  }
+  ret := 0
+  for m := 1; m <= 12; m++ {
+    ret += LunarMonthDays(year, m, false)
+  }
+  if leap := LeapMonth(year); leap > 0 {
+    ret += LunarMonthDays(year, leap, true)
+  }
+  return ret
+}
+
+// 公历日期转农历，使用t在自身时区中的日期（不考虑时分秒）
+func ToLunar(t time.Time) (LunarDate, error) {
+  days := int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Sub(lunarBase) / Day)
+  if days < 0 {
+    return LunarDate{}, base.ErrInvalidArgument
+  }
+  year := lunarMinYear
+  for ; year <= lunarMaxYear; year++ {
+    n := LunarYearDays(year)
+    if days < n {
+      break
+    }
+    days -= n
+  }
+  if year > lunarMaxYear {
+    return LunarDate{}, base.ErrInvalidArgument
+  }
+  leap := LeapMonth(year)
+  for m := 1; m <= 12; m++ {
+    n := LunarMonthDays(year, m, false)
+    if days < n {
+      return LunarDate{Year: year, Month: m, Day: days + 1}, nil
+    }
+    days -= n
+    if m == leap {
+      n = LunarMonthDays(year, m, true)
+      if days < n {
+        return LunarDate{Year: year, Month: m, Day: days + 1, Leap: true}, nil
+      }
+      days -= n
+    }
+  }
+  // 不会到这里
+  return LunarDate{}, base.ErrInvalidArgument
+}
+
+// 农历转公历，返回loc中该日的0点，日期不存在（如闰月不存在或大小月不对）时返回错误
+func (d LunarDate) ToSolar(loc *time.Location) (time.Time, error) {
+  n := LunarMonthDays(d.Year, d.Month, d.Leap)
+  if n == 0 || d.Day < 1 || d.Day > n {
+    return Nil, base.ErrInvalidArgument
+  }
+  if loc == nil {
+    loc = TimeZoneSH
+  }
+  days := d.Day - 1
+  for y := lunarMinYear; y < d.Year; y++ {
+    days += LunarYearDays(y)
+  }
+  leap := LeapMonth(d.Year)
+  for m := 1; m < d.Month; m++ {
+    days += LunarMonthDays(d.Year, m, false)
+    if m == leap {
+      days += LunarMonthDays(d.Year, m, true)
+    }
+  }
+  if d.Leap {
+    // 闰月在同名的月份之后
+    days += LunarMonthDays(d.Year, d.Month, false)
+  }
+  t := lunarBase.AddDate(0, 0, days)
+  return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc), nil
+}
+
+// 年的干支，按农历年（正月初一）划分，如"庚子"
+func (d LunarDate) YearGanZhi() string {
+  return YearGanZhi(d.Year)
+}
+
+// 生肖，按农历年（正月初一）划分
+func (d LunarDate) Zodiac() string {
+  return Zodiac(d.Year)
+}
+
+// 月份的中文名称，如"正月"、"闰四月"、"腊月"
+func (d LunarDate) MonthName() string {
+  if d.Month < 1 || d.Month > 12 {
+    return ""
+  }
+  s := lunarMonthNames[d.Month-1] + "月"
+  if d.Leap {
+    s = "闰" + s
+  }
+  return s
+}
+
+// 日的中文名称，如"初一"、"十五"、"廿三"、"三十"
+func (d LunarDate) DayName() string {
+  switch {
+  case d.Day < 1 || d.Day > 30:
+    return ""
+  case d.Day == 10:
+    return "初十"
+  case d.Day == 20:
+    return "二十"
+  case d.Day == 30:
+    return "三十"
+  }
+  return lunarDayNames[d.Day/10] + chineseDigits[d.Day%10]
+}
+
+// 如"二〇二〇年闰四月初一"
+func (d LunarDate) String() string {
+  y := d.Year
+  s := ""
+  for ; y > 0; y /= 10 {
+    s = chineseDigits[y%10] + s
+  }
+  return s + "年" + d.MonthName() + d.DayName()
+}
+
+// 干支纪年，如1984年为"甲子"
+func YearGanZhi(year int) string {
+  n := year - 4
+  return tianGan[mod(n, 10)] + diZhi[mod(n, 12)]
+}
+
+func Zodiac(year int) string {
+  return zodiacs[mod(year-4, 12)]
+}
+
+func mod(a, b int) int {
+  return (a%b + b) % b
+}
+
+// 二十四节气，从小寒开始（公历年中的顺序）
+var SolarTermNames = [24]string{
+  "小寒", "大寒", "立春", "雨水", "惊蛰", "春分", "清明", "谷雨", "立夏", "小满", "芒种", "夏至",
+  "小暑", "大暑", "立秋", "处暑", "白露", "秋分", "寒露", "霜降", "立冬", "小雪", "大雪", "冬至",
+}
+
+// year年第i个节气（0为小寒，见SolarTermNames）的时刻（TimeZoneSH），
+// 按Meeus的低精度太阳视黄经公式计算，误差在十几分钟以内，
+// 节气时刻接近午夜时日期可能相差一天
+func SolarTermTime(year, i int) time.Time {
+  if i < 0 || i >= 24 {
+    return Nil
+  }
+  // 小寒为285°，之后每个节气15°
+  target := math.Mod(285+float64(i)*15, 360)
+  // 初始值：小寒约在1月6日，每个节气约15.2天
+  jd := julianDay(time.Date(year, 1, 6, 0, 0, 0, 0, time.UTC)) + float64(i)*15.2184
+  for n := 0; n < 10; n++ {
+    diff := math.Mod(target-sunLongitude(jd)+540, 360) - 180
+    jd += diff * 365.2422 / 360
+    if math.Abs(diff) < 1e-7 {
+      break
+    }
+  }
+  return fromJulianDay(jd).In(TimeZoneSH)
+}
+
+// t所在日期（TimeZoneSH）的节气，不是节气返回false
+func SolarTerm(t time.Time) (string, bool) {
+  t = t.In(TimeZoneSH)
+  // 每个月有两个节气
+  for i := (int(t.Month()) - 1) * 2; i < int(t.Month())*2; i++ {
+    st := SolarTermTime(t.Year(), i)
+    if st.Day() == t.Day() {
+      return SolarTermNames[i], true
+    }
+  }
+  return "", false
+}
+
+// 儒略日（UT）
+func julianDay(t time.Time) float64 {
+  return float64(t.Unix())/86400 + 2440587.5
+}
+
+func fromJulianDay(jd float64) time.Time {
+  sec := (jd - 2440587.5) * 86400
+  return time.Unix(0, int64(math.Round(sec*1e3))*int64(time.Millisecond)).UTC()
+}
+
+// jd（UT）时太阳的视黄经（度），Astronomical Algorithms第25章的低精度算法
+func sunLongitude(jd float64) float64 {
+  // 转为力学时，ΔT用长期的近似公式，1900~2100年误差在几十秒以内
+  y := 2000 + (jd-2451545)/365.25
+  u := (y - 1820) / 100
+  jde := jd + (-20+32*u*u)/86400
+  t := (jde - 2451545) / 36525
+  l0 := 280.46646 + 36000.76983*t + 0.0003032*t*t
+  m := (357.52911 + 35999.05029*t - 0.0001537*t*t) * math.Pi / 180
+  c := (1.914602-0.004817*t-0.000014*t*t)*math.Sin(m) + (0.019993-0.000101*t)*math.Sin(2*m) + 0.000289*math.Sin(3*m)
+  omega := (125.04 - 1934.136*t) * math.Pi / 180
+  return math.Mod(l0+c-0.00569-0.00478*math.Sin(omega)+360*10, 360)
+}
+
+// 传统节日（农历节日及清明、冬至），一天可能有多个
+var lunarFestivals = map[int]string{
+  101:  "春节",
+  115:  "元宵节",
+  202:  "龙抬头",
+  505:  "端午节",
+  707:  "七夕",
+  715:  "中元节",
+  815:  "中秋节",
+  909:  "重阳节",
+  1208: "腊八节",
+  1223: "小年",
+}
+
+// t所在日期（TimeZoneSH）的传统节日，没有时返回nil
+func Festivals(t time.Time) []string {
+  t = t.In(TimeZoneSH)
+  var ret []string
+  if d, e := ToLunar(t); e == nil && !d.Leap {
+    if name, ok := lunarFestivals[d.Month*100+d.Day]; ok {
+      ret = append(ret, name)
+    }
+    // 除夕为腊月最后一天（可能是廿九）
+    if d.Month == 12 && d.Day == LunarMonthDays(d.Year, 12, false) {
+      ret = append(ret, "除夕")
+    }
+  }
+  if name, ok := SolarTerm(t); ok && (name == "清明" || name == "冬至") {
+    ret = append(ret, name)
+  }
+  return ret
+}
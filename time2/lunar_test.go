@@ -0,0 +1,80 @@
+package time2
+
+import (
+  "testing"
+  "time"
+)
+
+func day(s string) time.Time {
+  t, e := time.ParseInLocation(DateFormat, s, TimeZoneSH)
+  if e != nil {
+    panic(e)
+  }
+  return t
+}
+
+func TestLunar(t *testing.T) {
+  cases := map[string]LunarDate{
+    "2020-01-25": {2020, 1, 1, false},
+    "2020-05-23": {2020, 4, 1, true},
+    "2023-01-21": {2022, 12, 30, false},
+    "2023-03-22": {2023, 2, 1, true},
+    "1900-01-31": {1900, 1, 1, false},
+    "2024-09-17": {2024, 8, 15, false},
+  }
+  for s, want := range cases {
+    d := day(s)
+    got, e := ToLunar(d)
+    if e != nil || got != want {
+      t.Errorf("ToLunar(%s): got %v, %v", s, got, e)
+    }
+    v, e := want.ToSolar(TimeZoneSH)
+    if e != nil || !v.Equal(d) {
+      t.Errorf("ToSolar(%v): got %v, %v", want, v, e)
+    }
+  }
+  if _, e := ToLunar(day("1900-01-30")); e == nil {
+    t.Error("expected error")
+  }
+  if _, e := (LunarDate{2021, 4, 1, true}).ToSolar(nil); e == nil {
+    t.Error("expected error")
+  }
+  d := LunarDate{2020, 4, 1, true}
+  if d.String() != "二〇二〇年闰四月初一" || d.YearGanZhi() != "庚子" || d.Zodiac() != "鼠" {
+    t.Errorf("got %s, %s, %s", d, d.YearGanZhi(), d.Zodiac())
+  }
+  if YearGanZhi(1984) != "甲子" || (LunarDate{Month: 12, Day: 23}).DayName() != "廿三" {
+    t.Error("wrong name")
+  }
+  if LeapMonth(2023) != 2 || LeapMonth(2021) != 0 {
+    t.Error("wrong leap month")
+  }
+
+  st := SolarTermTime(2020, 2)
+  if want := time.Date(2020, 2, 4, 17, 3, 0, 0, TimeZoneSH); st.Sub(want) > 10*time.Minute || want.Sub(st) > 10*time.Minute {
+    t.Errorf("立春: got %v", st)
+  }
+  terms := map[string]string{
+    "2020-12-21": "冬至",
+    "2024-06-21": "夏至",
+    "2023-04-05": "清明",
+  }
+  for s, want := range terms {
+    if got, ok := SolarTerm(day(s)); !ok || got != want {
+      t.Errorf("%s: got %s", s, got)
+    }
+  }
+  if _, ok := SolarTerm(day("2023-04-06")); ok {
+    t.Error("expected no solar term")
+  }
+
+  if f := Festivals(day("2023-01-21")); len(f) != 1 || f[0] != "除夕" {
+    t.Errorf("got %v", f)
+  }
+  if f := Festivals(day("2024-09-17")); len(f) != 1 || f[0] != "中秋节" {
+    t.Errorf("got %v", f)
+  }
+  if f := Festivals(day("2023-04-05")); len(f) != 1 || f[0] != "清明" {
+    t.Errorf("got %v", f)
+  }
+}
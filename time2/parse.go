@@ -0,0 +1,158 @@
+package time2
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+)
+
+// Parse/ParseIn识别Unix时间戳时返回的layout
+const (
+  LayoutUnix      = "unix"
+  LayoutUnixMilli = "unix_ms"
+  LayoutUnixMicro = "unix_us"
+  LayoutUnixNano  = "unix_ns"
+)
+
+var (
+  // 内置的layout，同一种格式精度高的在前（time.Parse允许输入比layout多出小数秒）
+  builtinLayouts = []string{
+    time.RFC3339Nano,
+    time.RFC3339,
+    "2006-01-02T15:04:05",
+
+    DateTimeFormatMs, DateTimeFormatMs2, DateTimeFormatMs3, DateTimeFormatMs4,
+    DateTimeFormatSec, DateTimeFormatSec2, DateTimeFormatSec3, DateTimeFormatSec4,
+    DateTimeFormat, DateTimeFormat2, DateTimeFormat3, DateTimeFormat4,
+    DateFormat, DateFormat2, DateFormat3, DateFormat4,
+    TimeFormatMs, TimeFormatSec, TimeFormat,
+
+    time.RFC1123Z, time.RFC1123, time.RFC850, time.RFC822Z, time.RFC822,
+    time.UnixDate, time.RubyDate, time.ANSIC,
+  }
+
+  // RegisterLayout注册的layout，优先于内置的layout
+  customLayouts []string
+
+  layoutsMu sync.RWMutex
+)
+
+// 注册自定义layout，Parse/ParseIn会先按注册的顺序尝试这些layout
+func RegisterLayout(layouts ...string) {
+  layoutsMu.Lock()
+  defer layoutsMu.Unlock()
+  for _, layout := range layouts {
+    if layout == "" {
+      continue
+    }
+    exists := false
+    for _, l := range customLayouts {
+      if l == layout {
+        exists = true
+        break
+      }
+    }
+    if !exists {
+      customLayouts = append(customLayouts, layout)
+    }
+  }
+}
+
+// 所有Parse/ParseIn会尝试的layout（不包括时间戳和纯数字格式）
+func Layouts() []string {
+  layoutsMu.RLock()
+  defer layoutsMu.RUnlock()
+  ret := make([]string, 0, len(customLayouts)+len(builtinLayouts))
+  ret = append(ret, customLayouts...)
+  return append(ret, builtinLayouts...)
+}
+
+// 与ParseIn相同，没有时区的格式按UTC解析
+func Parse(s string) (time.Time, string, error) {
+  return ParseIn(s, time.UTC)
+}
+
+// 自动识别格式并解析，返回解析结果和匹配的layout，
+// 依次尝试自定义layout、纯数字格式、内置layout，
+// 纯数字按长度识别：
+// 8位为DateFormat5，12位为DateTimeFormat5，14位为DateTimeFormatSec5，17位为DateTimeFormatMs5，
+// 10/13/16/19位分别为秒/毫秒/微秒/纳秒时间戳（返回LayoutUnix等），
+// 没有时区的格式按loc解析（loc为nil时为UTC），时间戳转换为loc中的时间
+func ParseIn(s string, loc *time.Location) (time.Time, string, error) {
+  if loc == nil {
+    loc = time.UTC
+  }
+  s = strings.TrimSpace(s)
+  if s == "" {
+    return Nil, "", fmt.Errorf("time2: cannot parse empty string")
+  }
+  layoutsMu.RLock()
+  custom := customLayouts
+  layoutsMu.RUnlock()
+  for _, layout := range custom {
+    if t, e := time.ParseInLocation(layout, s, loc); e == nil {
+      return t, layout, nil
+    }
+  }
+  if isDigits(s) {
+    if t, layout, ok := parseDigits(s, loc); ok {
+      return t, layout, nil
+    }
+  }
+  for _, layout := range builtinLayouts {
+    if t, e := time.ParseInLocation(layout, s, loc); e == nil {
+      return t, layout, nil
+    }
+  }
+  return Nil, "", fmt.Errorf("time2: cannot parse %q", s)
+}
+
+func parseDigits(s string, loc *time.Location) (time.Time, string, bool) {
+  var layout string
+  switch len(s) {
+  case 8:
+    layout = DateFormat5
+  case 12:
+    layout = DateTimeFormat5
+  case 14:
+    layout = DateTimeFormatSec5
+  case 17:
+    // DateTimeFormatMs5末尾的000在time包中不是毫秒（没有小数点），需要单独处理
+    t, e := time.ParseInLocation(DateTimeFormatSec5, s[:14], loc)
+    if e != nil {
+      return Nil, "", false
+    }
+    ms, _ := strconv.Atoi(s[14:])
+    return t.Add(time.Duration(ms) * time.Millisecond), DateTimeFormatMs5, true
+  case 10, 13, 16, 19:
+    n, e := strconv.ParseInt(s, 10, 64)
+    if e != nil {
+      return Nil, "", false
+    }
+    switch len(s) {
+    case 10:
+      return time.Unix(n, 0).In(loc), LayoutUnix, true
+    case 13:
+      return time.Unix(0, n*int64(time.Millisecond)).In(loc), LayoutUnixMilli, true
+    case 16:
+      return time.Unix(0, n*int64(time.Microsecond)).In(loc), LayoutUnixMicro, true
+    default:
+      return time.Unix(0, n).In(loc), LayoutUnixNano, true
+    }
+  default:
+    return Nil, "", false
+  }
+  t, e := time.ParseInLocation(layout, s, loc)
+  return t, layout, e == nil
+}
+
+func isDigits(s string) bool {
+  for i := 0; i < len(s); i++ {
+    if s[i] < '0' || s[i] > '9' {
+      return false
+    }
+  }
+  return true
+}
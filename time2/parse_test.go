@@ -0,0 +1,50 @@
+package time2
+
+import (
+  "testing"
+  "time"
+)
+
+func TestParse(t *testing.T) {
+  want := time.Date(2020, 8, 13, 15, 4, 5, 123000000, TimeZoneSH)
+  cases := map[string]string{
+    "2020-08-13 15:04:05.123":       DateTimeFormatMs,
+    "2020/08/13 15:04:05.123":       DateTimeFormatMs3,
+    "20200813150405123":             DateTimeFormatMs5,
+    "2020-08-13T15:04:05.123+08:00": time.RFC3339Nano,
+    "1597302245123":                 LayoutUnixMilli,
+  }
+  for s, layout := range cases {
+    v, l, e := ParseIn(s, TimeZoneSH)
+    if e != nil || l != layout || !v.Equal(want) {
+      t.Errorf("%s: got %v, %s, %v", s, v, l, e)
+    }
+  }
+  cases = map[string]string{
+    "2020.08.13 15:04:05": DateTimeFormatSec4,
+    "20200813150405":      DateTimeFormatSec5,
+    "1597302245":          LayoutUnix,
+  }
+  for s, layout := range cases {
+    v, l, e := ParseIn(s, TimeZoneSH)
+    if e != nil || l != layout || !v.Equal(want.Truncate(time.Second)) {
+      t.Errorf("%s: got %v, %s, %v", s, v, l, e)
+    }
+  }
+  if v, l, e := Parse("20200813"); e != nil || l != DateFormat5 || !v.Equal(time.Date(2020, 8, 13, 0, 0, 0, 0, time.UTC)) {
+    t.Errorf("got %v, %s, %v", v, l, e)
+  }
+  if _, _, e := Parse("13 Aug 2020"); e == nil {
+    t.Error("expected error")
+  }
+  // 注册的layout是全局的，测试结束后还原，否则重复运行时上面的检查会失败
+  defer func() {
+    layoutsMu.Lock()
+    customLayouts = nil
+    layoutsMu.Unlock()
+  }()
+  RegisterLayout("02 Jan 2006")
+  if v, l, e := Parse("13 Aug 2020"); e != nil || l != "02 Jan 2006" || v.Day() != 13 {
+    t.Errorf("got %v, %s, %v", v, l, e)
+  }
+}
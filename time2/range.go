@@ -0,0 +1,222 @@
+package time2
+
+import (
+  "encoding/json"
+  "sort"
+  "time"
+
+  "github.com/kwf2030/commons/base"
+)
+
+// Range序列化为JSON时的格式，时区为DefaultCalendar的时区（默认TimeZoneSH），
+// 反序列化时用ParseIn自动识别格式
+var RangeFormat = DateTimeFormatSec
+
+// 时间段[Start, End)，End不晚于Start时为空
+type Range struct {
+  Start time.Time
+
+  End time.Time
+}
+
+func NewRange(start, end time.Time) (Range, error) {
+  if end.Before(start) {
+    return Range{}, base.ErrInvalidArgument
+  }
+  return Range{Start: start, End: end}, nil
+}
+
+func (r Range) Duration() time.Duration {
+  if r.IsEmpty() {
+    return 0
+  }
+  return r.End.Sub(r.Start)
+}
+
+func (r Range) IsEmpty() bool {
+  return !r.End.After(r.Start)
+}
+
+func (r Range) Contains(t time.Time) bool {
+  return !t.Before(r.Start) && t.Before(r.End)
+}
+
+// o是否完全在r之内（空的o不在任何Range之内）
+func (r Range) ContainsRange(o Range) bool {
+  return !o.IsEmpty() && !o.Start.Before(r.Start) && !o.End.After(r.End)
+}
+
+// 是否有重叠（只是首尾相接不算）
+func (r Range) Overlaps(o Range) bool {
+  return !r.IsEmpty() && !o.IsEmpty() && r.Start.Before(o.End) && o.Start.Before(r.End)
+}
+
+// 交集，没有重叠时返回false
+func (r Range) Intersect(o Range) (Range, bool) {
+  if !r.Overlaps(o) {
+    return Range{}, false
+  }
+  return Range{Start: later(r.Start, o.Start), End: earlier(r.End, o.End)}, true
+}
+
+// 并集，重叠或首尾相接时合并为一个，否则按时间顺序返回两个
+func (r Range) Union(o Range) []Range {
+  return MergeRanges([]Range{r, o})
+}
+
+// 差集（r中不在o中的部分），返回0~2个
+func (r Range) Subtract(o Range) []Range {
+  if r.IsEmpty() {
+    return nil
+  }
+  if !r.Overlaps(o) {
+    return []Range{r}
+  }
+  ret := make([]Range, 0, 2)
+  if r.Start.Before(o.Start) {
+    ret = append(ret, Range{Start: r.Start, End: o.Start})
+  }
+  if o.End.Before(r.End) {
+    ret = append(ret, Range{Start: o.End, End: r.End})
+  }
+  return ret
+}
+
+// 按loc中的自然日切分，第一段和最后一段可能不足一天
+func (r Range) SplitByDay(loc *time.Location) []Range {
+  return r.split(loc, func(t time.Time) time.Time {
+    return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+  })
+}
+
+// 按loc中的整点切分（对于非整小时的时区，如+05:30，与UTC的整点不同）
+func (r Range) SplitByHour(loc *time.Location) []Range {
+  return r.split(loc, func(t time.Time) time.Time {
+    return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+  })
+}
+
+// 按固定时长d切分，最后一段可能不足d
+func (r Range) Split(d time.Duration) []Range {
+  if d <= 0 {
+    return nil
+  }
+  return r.split(nil, func(t time.Time) time.Time {
+    return t.Add(d)
+  })
+}
+
+// loc为nil时不转换时区，next返回t之后的下一个切分点
+func (r Range) split(loc *time.Location, next func(time.Time) time.Time) []Range {
+  if r.IsEmpty() {
+    return nil
+  }
+  ret := make([]Range, 0, 8)
+  start := r.Start
+  if loc != nil {
+    start = start.In(loc)
+  }
+  for start.Before(r.End) {
+    end := earlier(next(start), r.End)
+    ret = append(ret, Range{Start: start, End: end})
+    start = end
+  }
+  return ret
+}
+
+// 从Start开始每隔step调用一次f（不包括End），f返回false时停止
+func (r Range) Each(step time.Duration, f func(time.Time) bool) {
+  if step <= 0 {
+    return
+  }
+  for t := r.Start; t.Before(r.End); t = t.Add(step) {
+    if !f(t) {
+      return
+    }
+  }
+}
+
+// 对loc中的每一天（与r的交集）调用f，f返回false时停止
+func (r Range) EachDay(loc *time.Location, f func(Range) bool) {
+  for _, day := range r.SplitByDay(loc) {
+    if !f(day) {
+      return
+    }
+  }
+}
+
+func (r Range) String() string {
+  return "[" + r.Start.Format(DateTimeFormatMs) + ", " + r.End.Format(DateTimeFormatMs) + ")"
+}
+
+type rangeJSON struct {
+  Start string `json:"start"`
+
+  End string `json:"end"`
+}
+
+func (r Range) MarshalJSON() ([]byte, error) {
+  loc := DefaultCalendar.Location()
+  return json.Marshal(rangeJSON{
+    Start: r.Start.In(loc).Format(RangeFormat),
+    End:   r.End.In(loc).Format(RangeFormat),
+  })
+}
+
+// end早于start时返回base.ErrInvalidArgument
+func (r *Range) UnmarshalJSON(data []byte) error {
+  var v rangeJSON
+  if e := json.Unmarshal(data, &v); e != nil {
+    return e
+  }
+  loc := DefaultCalendar.Location()
+  start, _, e := ParseIn(v.Start, loc)
+  if e != nil {
+    return e
+  }
+  end, _, e := ParseIn(v.End, loc)
+  if e != nil {
+    return e
+  }
+  if end.Before(start) {
+    return base.ErrInvalidArgument
+  }
+  r.Start, r.End = start, end
+  return nil
+}
+
+// 按开始时间排序并合并重叠或首尾相接的Range，忽略空的Range
+func MergeRanges(rs []Range) []Range {
+  sorted := make([]Range, 0, len(rs))
+  for _, r := range rs {
+    if !r.IsEmpty() {
+      sorted = append(sorted, r)
+    }
+  }
+  sort.Slice(sorted, func(i, j int) bool {
+    return sorted[i].Start.Before(sorted[j].Start)
+  })
+  ret := make([]Range, 0, len(sorted))
+  for _, r := range sorted {
+    if n := len(ret); n > 0 && !r.Start.After(ret[n-1].End) {
+      ret[n-1].End = later(ret[n-1].End, r.End)
+      continue
+    }
+    ret = append(ret, r)
+  }
+  return ret
+}
+
+func earlier(a, b time.Time) time.Time {
+  if a.Before(b) {
+    return a
+  }
+  return b
+}
+
+func later(a, b time.Time) time.Time {
+  if a.After(b) {
+    return a
+  }
+  return b
+}
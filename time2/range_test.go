@@ -0,0 +1,58 @@
+package time2
+
+import (
+  "encoding/json"
+  "testing"
+  "time"
+)
+
+func TestRange(t *testing.T) {
+  c := DefaultCalendar
+  r := Range{Start: date(c, "2020-08-13 10:00:00"), End: date(c, "2020-08-13 18:00:00")}
+  o := Range{Start: date(c, "2020-08-13 12:00:00"), End: date(c, "2020-08-13 14:00:00")}
+  if !r.Contains(o.Start) || r.Contains(r.End) || !r.ContainsRange(o) || !r.Overlaps(o) {
+    t.Error("unexpected relation")
+  }
+  if v, ok := r.Intersect(o); !ok || v != o {
+    t.Errorf("unexpected intersection: %v", v)
+  }
+  if v := r.Subtract(o); len(v) != 2 || v[0].End != o.Start || v[1].Start != o.End {
+    t.Errorf("unexpected subtraction: %v", v)
+  }
+  next := Range{Start: r.End, End: r.End.Add(time.Hour)}
+  if v := r.Union(next); len(v) != 1 || v[0].End != next.End {
+    t.Errorf("unexpected union: %v", v)
+  }
+  if r.Overlaps(next) {
+    t.Error("adjacent ranges should not overlap")
+  }
+
+  long := Range{Start: date(c, "2020-08-13 22:30:00"), End: date(c, "2020-08-15 01:00:00")}
+  days := long.SplitByDay(c.Location())
+  if len(days) != 3 || days[0].Duration() != time.Minute*90 || days[1].Duration() != Day || days[2].Duration() != time.Hour {
+    t.Errorf("unexpected days: %v", days)
+  }
+  if hours := long.SplitByHour(c.Location()); len(hours) != 27 || hours[0].Duration() != time.Minute*30 {
+    t.Errorf("unexpected hours: %d", len(hours))
+  }
+  n := 0
+  long.Each(time.Hour*12, func(time.Time) bool {
+    n++
+    return true
+  })
+  if n != 3 {
+    t.Errorf("expected 3 iterations, got %d", n)
+  }
+
+  data, e := json.Marshal(r)
+  if e != nil || string(data) != `{"start":"2020-08-13 10:00:00","end":"2020-08-13 18:00:00"}` {
+    t.Fatalf("unexpected json: %s, %v", data, e)
+  }
+  var v Range
+  if e = json.Unmarshal(data, &v); e != nil || !v.Start.Equal(r.Start) || !v.End.Equal(r.End) {
+    t.Errorf("unexpected range: %v, %v", v, e)
+  }
+  if e = json.Unmarshal([]byte(`{"start":"2020-08-13 18:00:00","end":"2020-08-13 10:00:00"}`), &v); e == nil {
+    t.Error("expected error for inverted range")
+  }
+}
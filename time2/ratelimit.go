@@ -0,0 +1,171 @@
+package time2
+
+import (
+  "context"
+  "errors"
+  "sync"
+  "time"
+)
+
+var ErrRateLimited = errors.New("time2: rate limited")
+
+// 限流器，基于GCRA（generic cell rate algorithm）实现，
+// 只记录下一个请求的理论到达时间（tat），不需要定时补充令牌，
+// 令牌桶（NewTokenBucket）和漏桶（NewLeakyBucket）只是参数不同
+type RateLimiter struct {
+  clock Clock
+
+  // 每个请求（令牌）的间隔
+  interval time.Duration
+
+  // 可以立即通过的请求数
+  burst int
+
+  // 最多可以排队等待多久，<0表示不限
+  maxDelay time.Duration
+
+  // 理论到达时间，tat-now为当前已经占用的额度
+  tat time.Time
+
+  mu sync.Mutex
+}
+
+// 令牌桶，每interval生成一个令牌，最多积攒burst个，
+// 令牌足够时立即通过，不够时Reserve/Wait需要等待（不限等待时间），Allow返回false
+func NewTokenBucket(clock Clock, interval time.Duration, burst int) *RateLimiter {
+  return newRateLimiter(clock, interval, burst, -1)
+}
+
+// 漏桶，请求以固定的间隔interval通过，不允许突发，
+// 最多capacity个请求排队等待，队列满时Reserve/Wait失败
+func NewLeakyBucket(clock Clock, interval time.Duration, capacity int) *RateLimiter {
+  if capacity < 0 {
+    return nil
+  }
+  return newRateLimiter(clock, interval, 1, time.Duration(capacity)*interval)
+}
+
+func newRateLimiter(clock Clock, interval time.Duration, burst int, maxDelay time.Duration) *RateLimiter {
+  if interval <= 0 || burst <= 0 {
+    return nil
+  }
+  if clock == nil {
+    clock = RealClock
+  }
+  return &RateLimiter{
+    clock:    clock,
+    interval: interval,
+    burst:    burst,
+    maxDelay: maxDelay,
+    mu:       sync.Mutex{},
+  }
+}
+
+// 是否可以立即通过，可以时消耗一个令牌
+func (l *RateLimiter) Allow() bool {
+  l.mu.Lock()
+  defer l.mu.Unlock()
+  _, ok := l.reserve(l.clock.Now(), 0)
+  return ok
+}
+
+// 预定一个令牌，返回的Reservation表示需要等待多久才能通过，
+// 预定失败（漏桶的队列已满）时Reservation.OK返回false
+func (l *RateLimiter) Reserve() *Reservation {
+  l.mu.Lock()
+  defer l.mu.Unlock()
+  now := l.clock.Now()
+  delay, ok := l.reserve(now, l.maxDelay)
+  return &Reservation{l: l, ok: ok, at: now.Add(delay), delay: delay}
+}
+
+// 阻塞直到可以通过，
+// 需要等待的时间超过ctx的deadline或排队已满时立即返回ErrRateLimited（不消耗令牌），
+// ctx结束时返回ctx.Err()并归还令牌
+func (l *RateLimiter) Wait(ctx context.Context) error {
+  if ctx == nil {
+    ctx = context.Background()
+  }
+  if e := ctx.Err(); e != nil {
+    return e
+  }
+  l.mu.Lock()
+  now := l.clock.Now()
+  maxDelay := l.maxDelay
+  if deadline, ok := ctx.Deadline(); ok {
+    if d := deadline.Sub(now); maxDelay < 0 || d < maxDelay {
+      maxDelay = d
+    }
+  }
+  delay, ok := l.reserve(now, maxDelay)
+  l.mu.Unlock()
+  if !ok {
+    return ErrRateLimited
+  }
+  if delay == 0 {
+    return nil
+  }
+  r := &Reservation{l: l, ok: true, at: now.Add(delay), delay: delay}
+  select {
+  case <-l.clock.After(delay):
+    return nil
+  case <-ctx.Done():
+    r.Cancel()
+    return ctx.Err()
+  }
+}
+
+// 需要持有锁，maxDelay<0表示不限等待时间
+func (l *RateLimiter) reserve(now time.Time, maxDelay time.Duration) (time.Duration, bool) {
+  tat := l.tat
+  if tat.Before(now) {
+    tat = now
+  }
+  tat = tat.Add(l.interval)
+  delay := tat.Sub(now) - time.Duration(l.burst)*l.interval
+  if delay < 0 {
+    delay = 0
+  }
+  if maxDelay >= 0 && delay > maxDelay {
+    return 0, false
+  }
+  l.tat = tat
+  return delay, true
+}
+
+type Reservation struct {
+  l *RateLimiter
+
+  ok bool
+
+  // 可以通过的时间
+  at time.Time
+
+  delay time.Duration
+
+  cancelled bool
+}
+
+func (r *Reservation) OK() bool {
+  return r.ok
+}
+
+// 预定时需要等待的时间，预定失败时为0
+func (r *Reservation) Delay() time.Duration {
+  return r.delay
+}
+
+// 不再使用预定的令牌，还没到通过时间时归还，
+// 之后的预定可以因此提前（之前已经预定的不受影响）
+func (r *Reservation) Cancel() {
+  if !r.ok || r.cancelled {
+    return
+  }
+  r.cancelled = true
+  l := r.l
+  l.mu.Lock()
+  defer l.mu.Unlock()
+  if r.at.After(l.clock.Now()) {
+    l.tat = l.tat.Add(-l.interval)
+  }
+}
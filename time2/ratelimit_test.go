@@ -0,0 +1,85 @@
+package time2
+
+import (
+  "context"
+  "testing"
+  "time"
+)
+
+func TestTokenBucket(t *testing.T) {
+  clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+  l := NewTokenBucket(clock, time.Millisecond*100, 3)
+  for i := 0; i < 3; i++ {
+    if !l.Allow() {
+      t.Fatalf("burst %d not allowed", i)
+    }
+  }
+  if l.Allow() {
+    t.Error("allowed without tokens")
+  }
+  clock.Advance(time.Millisecond * 250)
+  if !l.Allow() || !l.Allow() || l.Allow() {
+    t.Error("expected 2 tokens after 250ms")
+  }
+  r := l.Reserve()
+  if !r.OK() || r.Delay() != time.Millisecond*50 {
+    t.Errorf("unexpected reservation: %v, %v", r.OK(), r.Delay())
+  }
+  r.Cancel()
+  if r = l.Reserve(); r.Delay() != time.Millisecond*50 {
+    t.Errorf("token not returned, delay %v", r.Delay())
+  }
+
+  ctx, cancel := context.WithCancel(context.Background())
+  done := make(chan error)
+  go func() {
+    done <- l.Wait(ctx)
+  }()
+  cancel()
+  if e := <-done; e != context.Canceled {
+    t.Errorf("expected context.Canceled, got %v", e)
+  }
+  if r = l.Reserve(); r.Delay() != time.Millisecond*150 {
+    t.Errorf("token not returned, delay %v", r.Delay())
+  }
+  go func() {
+    done <- l.Wait(context.Background())
+  }()
+  advanceUntilDone(t, clock, time.Millisecond*10, done)
+}
+
+func TestLeakyBucket(t *testing.T) {
+  clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+  l := NewLeakyBucket(clock, time.Millisecond*100, 2)
+  delays := []time.Duration{0, time.Millisecond * 100, time.Millisecond * 200}
+  for _, d := range delays {
+    if r := l.Reserve(); !r.OK() || r.Delay() != d {
+      t.Errorf("expected delay %v, got %v, %v", d, r.OK(), r.Delay())
+    }
+  }
+  if l.Reserve().OK() {
+    t.Error("reserved with a full queue")
+  }
+  if e := l.Wait(context.Background()); e != ErrRateLimited {
+    t.Errorf("expected ErrRateLimited, got %v", e)
+  }
+  clock.Advance(time.Millisecond * 100)
+  if r := l.Reserve(); !r.OK() || r.Delay() != time.Millisecond*200 {
+    t.Errorf("unexpected reservation: %v, %v", r.OK(), r.Delay())
+  }
+}
+
+func advanceUntilDone(t *testing.T, clock *FakeClock, step time.Duration, done chan error) {
+  for i := 0; i < 1000; i++ {
+    select {
+    case e := <-done:
+      if e != nil {
+        t.Error(e)
+      }
+      return
+    case <-time.After(time.Millisecond):
+      clock.Advance(step)
+    }
+  }
+  t.Fatal("not done")
+}
@@ -0,0 +1,142 @@
+package time2
+
+import (
+  "sync"
+  "sync/atomic"
+  "time"
+)
+
+// 分片的时间轮，task按id分到N个独立加锁的TimingWheel中，
+// 大量goroutine同时添加/取消task时减少锁竞争，
+// Cancel不需要加锁（只把task标记为已取消，下一次tick时再从时间轮中移除）
+type ShardedTimingWheel struct {
+  shards []*TimingWheel
+
+  seq uint64
+
+  // 每个分片中还没执行的task，key为task id，Cancel时不需要加锁就能找到task
+  live []sync.Map
+}
+
+var _ Scheduler = (*ShardedTimingWheel)(nil)
+
+// shards为分片数量，slots、dps和opts用于创建每个分片，
+// opts会作用到每个分片上（如WithClock、WithExecutor），不支持WithJournal
+func NewShardedTimingWheel(shards, slots int, dps time.Duration, opts ...Option) *ShardedTimingWheel {
+  if shards <= 0 {
+    return nil
+  }
+  s := &ShardedTimingWheel{
+    shards: make([]*TimingWheel, shards),
+    live:   make([]sync.Map, shards),
+  }
+  for i := range s.shards {
+    if s.shards[i] = NewTimingWheel(slots, dps, opts...); s.shards[i] == nil {
+      return nil
+    }
+  }
+  return s
+}
+
+func (s *ShardedTimingWheel) Start() {
+  for _, tw := range s.shards {
+    tw.Start()
+  }
+}
+
+func (s *ShardedTimingWheel) Stop() {
+  for _, tw := range s.shards {
+    tw.Stop()
+  }
+}
+
+func (s *ShardedTimingWheel) Delay(delay time.Duration, data interface{}, f func(uint64, interface{})) uint64 {
+  if delay <= 0 || f == nil {
+    return 0
+  }
+  id := atomic.AddUint64(&s.seq, 1)
+  i := s.shard(id)
+  live := &s.live[i]
+  t := s.shards[i].delayWithID(id, delay, data, func(id uint64, data interface{}) {
+    live.Delete(id)
+    f(id, data)
+  })
+  live.Store(id, t)
+  // 存入live之前可能已经执行了（执行时的Delete在Store之前）
+  if atomic.LoadInt32(&t.state) != taskPending {
+    live.Delete(id)
+  }
+  return id
+}
+
+func (s *ShardedTimingWheel) At(t time.Time, data interface{}, f func(uint64, interface{})) uint64 {
+  if f == nil {
+    return 0
+  }
+  if now := s.shards[0].clock.Now(); t.After(now) {
+    return s.Delay(t.Sub(now), data, f)
+  }
+  return 0
+}
+
+// 计时期间不加锁（task在下一次tick时才从时间轮中移除），返回是否在执行之前取消了task
+func (s *ShardedTimingWheel) Cancel(id uint64) bool {
+  i := s.shard(id)
+  v, ok := s.live[i].Load(id)
+  if !ok {
+    return false
+  }
+  t := v.(*task)
+  if !atomic.CompareAndSwapInt32(&t.state, taskPending, taskCancelled) {
+    return false
+  }
+  s.live[i].Delete(id)
+  tw := s.shards[i]
+  tw.pushCancelled(t)
+  if atomic.LoadInt32(&tw.ticking) == 0 {
+    // 没有在计时（停止/暂停/还没启动）时不会tick，直接移除，避免取消的task一直堆积
+    tw.mu.Lock()
+    tw.purge()
+    tw.mu.Unlock()
+  }
+  tw.metrics.cancel()
+  if tw.observer != nil {
+    tw.observer.OnCancel(id)
+  }
+  return true
+}
+
+// 各分片的统计数据之和（SlotPending为各分片对应slot之和），
+// Pending包括已经取消但还没从时间轮中移除的task
+func (s *ShardedTimingWheel) Stats() Stats {
+  var ret Stats
+  for i, tw := range s.shards {
+    st := tw.Stats()
+    if i == 0 {
+      ret = st
+      continue
+    }
+    ret.Scheduled += st.Scheduled
+    ret.Fired += st.Fired
+    ret.Cancelled += st.Cancelled
+    ret.Ticks += st.Ticks
+    ret.Expired += st.Expired
+    ret.Pending += st.Pending
+    for j, slots := range st.SlotPending {
+      if j == len(ret.SlotPending) {
+        ret.SlotPending = append(ret.SlotPending, make([]int, len(slots)))
+      }
+      for k, n := range slots {
+        ret.SlotPending[j][k] += n
+      }
+    }
+    ret.FireLag.merge(st.FireLag)
+    ret.TickDuration.merge(st.TickDuration)
+  }
+  return ret
+}
+
+// id所在的分片
+func (s *ShardedTimingWheel) shard(id uint64) int {
+  return int(id % uint64(len(s.shards)))
+}
@@ -0,0 +1,75 @@
+package time2
+
+import (
+  "runtime"
+  "sync"
+  "sync/atomic"
+  "testing"
+  "time"
+)
+
+func TestShardedTimingWheel(t *testing.T) {
+  clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+  o := &countObserver{}
+  s := NewShardedTimingWheel(4, 10, time.Millisecond*100, WithClock(clock), WithObserver(o))
+  s.Start()
+  defer s.Stop()
+  var fired int32
+  var wg sync.WaitGroup
+  ids := make([]uint64, 0, 100)
+  for i := 0; i < 100; i++ {
+    wg.Add(1)
+    ids = append(ids, s.Delay(time.Millisecond*time.Duration(100+i*10), i, func(id uint64, data interface{}) {
+      atomic.AddInt32(&fired, 1)
+      wg.Done()
+    }))
+  }
+  // 取消一半
+  for i := 0; i < 100; i += 2 {
+    if !s.Cancel(ids[i]) || s.Cancel(ids[i]) {
+      t.Errorf("unexpected cancel result for %d", ids[i])
+    }
+    wg.Done()
+  }
+  advanceUntil(t, clock, time.Millisecond*100, time.Second*3, &wg)
+  if n := atomic.LoadInt32(&fired); n != 50 {
+    t.Errorf("expected 50 fired, got %d", n)
+  }
+  if s.Cancel(ids[1]) {
+    t.Error("cancelled a fired task")
+  }
+  st := s.Stats()
+  if st.Scheduled != 100 || st.Cancelled != 50 || st.Pending != 0 {
+    t.Errorf("unexpected stats: %+v", st)
+  }
+  if o.cancelled != 50 {
+    t.Errorf("expected 50 OnCancel, got %d", o.cancelled)
+  }
+
+  // 停止期间取消的task直接移除
+  s.Stop()
+  id := s.Delay(time.Second, "stopped", func(uint64, interface{}) {})
+  if !s.Cancel(id) || s.Stats().Pending != 0 {
+    t.Errorf("cancelled task not purged while stopped: %+v", s.Stats())
+  }
+}
+
+func BenchmarkParallelDelayCancel(b *testing.B) {
+  fn := func(uint64, interface{}) {}
+  run := func(b *testing.B, s Scheduler) {
+    s.Start()
+    defer s.Stop()
+    b.ResetTimer()
+    b.RunParallel(func(pb *testing.PB) {
+      for pb.Next() {
+        s.Cancel(s.Delay(time.Second, nil, fn))
+      }
+    })
+  }
+  b.Run("TimingWheel", func(b *testing.B) {
+    run(b, NewTimingWheel(60, time.Millisecond*10))
+  })
+  b.Run("ShardedTimingWheel", func(b *testing.B) {
+    run(b, NewShardedTimingWheel(runtime.GOMAXPROCS(0), 60, time.Millisecond*10))
+  })
+}
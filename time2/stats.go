@@ -0,0 +1,272 @@
+package time2
+
+import (
+  "expvar"
+  "fmt"
+  "io"
+  "strconv"
+  "sync/atomic"
+  "time"
+)
+
+// 时间轮事件的观察者，
+// OnSchedule在持有时间轮的锁时调用，OnFire在执行task的goroutine中调用，
+// 所有方法都不能阻塞，也不能调用TimingWheel的方法
+type Observer interface {
+  // 添加了task
+  OnSchedule(id uint64, deadline time.Time)
+
+  // task开始执行，lag为实际执行时间与期望执行时间的差
+  OnFire(id uint64, lag time.Duration)
+
+  // 通过Cancel取消了task
+  OnCancel(id uint64)
+
+  // 一次tick结束，d为tick持有锁的时间，expired为到期的task数量
+  OnTick(d time.Duration, expired int)
+}
+
+// Observer同时实现了JournalObserver时，接收写日志失败的通知，
+// 在持有时间轮的锁时调用，与Observer一样不能阻塞，也不能调用TimingWheel的方法
+type JournalObserver interface {
+  // 执行完、取消、Reset或暂停后恢复时写日志失败，id为对应的task，
+  // 时间轮中的task不受影响，但重启后日志中的记录可能已经过时
+  OnJournalError(id uint64, e error)
+}
+
+func WithObserver(o Observer) Option {
+  return func(tw *TimingWheel) {
+    tw.observer = o
+  }
+}
+
+var (
+  // 执行延迟的分桶上限
+  lagBounds = []time.Duration{
+    time.Millisecond, time.Millisecond * 5, time.Millisecond * 10, time.Millisecond * 50,
+    time.Millisecond * 100, time.Millisecond * 500, time.Second, time.Second * 5,
+    time.Second * 10, time.Second * 30, time.Minute,
+  }
+
+  // tick耗时的分桶上限
+  tickBounds = []time.Duration{
+    time.Microsecond * 10, time.Microsecond * 50, time.Microsecond * 100, time.Microsecond * 500,
+    time.Millisecond, time.Millisecond * 5, time.Millisecond * 10, time.Millisecond * 50,
+    time.Millisecond * 100,
+  }
+)
+
+type metrics struct {
+  // 64位原子操作的字段放在最前面，保证32位平台上的对齐
+  scheduled uint64
+  fired     uint64
+  cancelled uint64
+  ticks     uint64
+  expired   uint64
+
+  lag *histogram
+
+  tickDur *histogram
+}
+
+func newMetrics() *metrics {
+  return &metrics{
+    lag:     newHistogram(lagBounds),
+    tickDur: newHistogram(tickBounds),
+  }
+}
+
+func (m *metrics) schedule() {
+  atomic.AddUint64(&m.scheduled, 1)
+}
+
+func (m *metrics) fire(lag time.Duration) {
+  atomic.AddUint64(&m.fired, 1)
+  m.lag.observe(lag)
+}
+
+func (m *metrics) cancel() {
+  atomic.AddUint64(&m.cancelled, 1)
+}
+
+func (m *metrics) tick(d time.Duration, expired int) {
+  atomic.AddUint64(&m.ticks, 1)
+  atomic.AddUint64(&m.expired, uint64(expired))
+  m.tickDur.observe(d)
+}
+
+// 固定分桶的直方图，可以并发调用observe，
+// 与LatencyHistogram不同，桶的上限是固定的几个值，用于WritePrometheus（le标签的上限要固定且精确计数）和Stats，
+// LatencyHistogram的对数-线性分桶有上千个桶，桶的边界也与这些上限对不上，换算后的计数不准确
+type histogram struct {
+  count uint64
+
+  // 纳秒
+  sum int64
+
+  bounds []time.Duration
+
+  // 比bounds多一个，最后一个为+Inf
+  counts []uint64
+}
+
+func newHistogram(bounds []time.Duration) *histogram {
+  return &histogram{
+    bounds: bounds,
+    counts: make([]uint64, len(bounds)+1),
+  }
+}
+
+func (h *histogram) observe(d time.Duration) {
+  i := 0
+  for ; i < len(h.bounds); i++ {
+    if d <= h.bounds[i] {
+      break
+    }
+  }
+  atomic.AddUint64(&h.counts[i], 1)
+  atomic.AddUint64(&h.count, 1)
+  atomic.AddInt64(&h.sum, int64(d))
+}
+
+func (h *histogram) snapshot() HistogramSnapshot {
+  ret := HistogramSnapshot{
+    Count:  atomic.LoadUint64(&h.count),
+    Sum:    time.Duration(atomic.LoadInt64(&h.sum)),
+    Bounds: h.bounds,
+    Counts: make([]uint64, len(h.counts)),
+  }
+  for i := range h.counts {
+    ret.Counts[i] = atomic.LoadUint64(&h.counts[i])
+  }
+  return ret
+}
+
+type HistogramSnapshot struct {
+  Count uint64
+
+  Sum time.Duration
+
+  // 每个桶的上限（包含）
+  Bounds []time.Duration
+
+  // 每个桶的数量（非累计），比Bounds多一个，最后一个表示超过所有上限的数量
+  Counts []uint64
+}
+
+// 合并分桶相同的直方图
+func (h *HistogramSnapshot) merge(o HistogramSnapshot) {
+  h.Count += o.Count
+  h.Sum += o.Sum
+  for i := range h.Counts {
+    h.Counts[i] += o.Counts[i]
+  }
+}
+
+type Stats struct {
+  // 累计添加/执行/取消的task数量
+  Scheduled uint64
+  Fired     uint64
+  Cancelled uint64
+
+  // 累计tick次数和到期的task数量
+  Ticks   uint64
+  Expired uint64
+
+  // 当前还没执行的task数量
+  Pending int
+
+  // 每层时间轮每个slot中的task数量，SlotPending[0]为精度最高的一层
+  SlotPending [][]int
+
+  // 执行延迟（实际执行时间与期望执行时间的差）
+  FireLag HistogramSnapshot
+
+  // 每次tick持有锁的时间
+  TickDuration HistogramSnapshot
+}
+
+func (tw *TimingWheel) Stats() Stats {
+  m := tw.metrics
+  ret := Stats{
+    Scheduled:    atomic.LoadUint64(&m.scheduled),
+    Fired:        atomic.LoadUint64(&m.fired),
+    Cancelled:    atomic.LoadUint64(&m.cancelled),
+    Ticks:        atomic.LoadUint64(&m.ticks),
+    Expired:      atomic.LoadUint64(&m.expired),
+    FireLag:      m.lag.snapshot(),
+    TickDuration: m.tickDur.snapshot(),
+  }
+  tw.mu.Lock()
+  ret.Pending = len(tw.tasks)
+  ret.SlotPending = make([][]int, len(tw.levels))
+  for i, l := range tw.levels {
+    ret.SlotPending[i] = make([]int, len(l.buckets))
+    for j, bucket := range l.buckets {
+      ret.SlotPending[i][j] = len(bucket)
+    }
+  }
+  tw.mu.Unlock()
+  return ret
+}
+
+// 以name发布到expvar（/debug/vars），每次访问时调用Stats，
+// 与expvar.Publish一样，name重复时会panic
+func (tw *TimingWheel) PublishExpvar(name string) {
+  expvar.Publish(name, expvar.Func(func() interface{} {
+    return tw.Stats()
+  }))
+}
+
+// 以Prometheus文本格式输出统计数据，prefix为指标名前缀（如"timing_wheel"），
+// 可以直接作为HTTP handler的响应，不依赖Prometheus客户端库
+func (tw *TimingWheel) WritePrometheus(w io.Writer, prefix string) error {
+  s := tw.Stats()
+  ew := &errWriter{w: w}
+  writeMetric(ew, prefix+"_scheduled_total", "counter", "Total number of scheduled tasks.", s.Scheduled)
+  writeMetric(ew, prefix+"_fired_total", "counter", "Total number of fired tasks.", s.Fired)
+  writeMetric(ew, prefix+"_cancelled_total", "counter", "Total number of cancelled tasks.", s.Cancelled)
+  writeMetric(ew, prefix+"_ticks_total", "counter", "Total number of ticks.", s.Ticks)
+  writeMetric(ew, prefix+"_pending", "gauge", "Number of pending tasks.", uint64(s.Pending))
+  name := prefix + "_slot_pending"
+  ew.printf("# HELP %s Number of pending tasks per slot (empty slots omitted).\n# TYPE %s gauge\n", name, name)
+  for i, slots := range s.SlotPending {
+    for j, n := range slots {
+      if n > 0 {
+        ew.printf("%s{level=\"%d\",slot=\"%d\"} %d\n", name, i, j, n)
+      }
+    }
+  }
+  writeHistogram(ew, prefix+"_fire_lag_seconds", "Delay between deadline and actual execution.", s.FireLag)
+  writeHistogram(ew, prefix+"_tick_duration_seconds", "Time spent holding the lock per tick.", s.TickDuration)
+  return ew.e
+}
+
+func writeMetric(w *errWriter, name, typ, help string, v uint64) {
+  w.printf("# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, typ, name, v)
+}
+
+func writeHistogram(w *errWriter, name, help string, h HistogramSnapshot) {
+  w.printf("# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+  var n uint64
+  for i, b := range h.Bounds {
+    n += h.Counts[i]
+    w.printf("%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(b.Seconds(), 'g', -1, 64), n)
+  }
+  w.printf("%s_bucket{le=\"+Inf\"} %d\n", name, h.Count)
+  w.printf("%s_sum %s\n", name, strconv.FormatFloat(h.Sum.Seconds(), 'g', -1, 64))
+  w.printf("%s_count %d\n", name, h.Count)
+}
+
+// 出错后不再写入，只保留第一个错误
+type errWriter struct {
+  w io.Writer
+
+  e error
+}
+
+func (w *errWriter) printf(format string, args ...interface{}) {
+  if w.e == nil {
+    _, w.e = fmt.Fprintf(w.w, format, args...)
+  }
+}
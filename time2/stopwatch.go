@@ -0,0 +1,186 @@
+package time2
+
+import (
+  "io"
+  "strings"
+  "sync"
+  "time"
+)
+
+type Lap struct {
+  Name string
+
+  // 与上一个Lap（或开始）的间隔
+  Duration time.Duration
+
+  // 从开始到这个Lap的累计时间（不包括暂停的时间）
+  Total time.Duration
+}
+
+// 秒表，可以暂停（Stop后再Start继续累计）、记录Lap和嵌套子Span，可以并发调用
+type Stopwatch struct {
+  Name string
+
+  clock Clock
+
+  running bool
+
+  // 最近一次Start的时间
+  start time.Time
+
+  // 最近一次Start之前累计的时间
+  elapsed time.Duration
+
+  // 最近一个Lap的累计时间
+  lastLap time.Duration
+
+  laps []Lap
+
+  spans []*Stopwatch
+
+  mu sync.Mutex
+}
+
+// 创建并开始计时，clock为nil时为RealClock
+func StartStopwatch(clock Clock, name string) *Stopwatch {
+  sw := NewStopwatch(clock, name)
+  sw.Start()
+  return sw
+}
+
+// 创建秒表（不开始计时），clock为nil时为RealClock
+func NewStopwatch(clock Clock, name string) *Stopwatch {
+  if clock == nil {
+    clock = RealClock
+  }
+  return &Stopwatch{Name: name, clock: clock}
+}
+
+// 开始或继续计时，已经在计时时什么都不做
+func (sw *Stopwatch) Start() {
+  sw.mu.Lock()
+  defer sw.mu.Unlock()
+  if !sw.running {
+    sw.running = true
+    sw.start = sw.clock.Now()
+  }
+}
+
+// 暂停计时，返回累计的时间
+func (sw *Stopwatch) Stop() time.Duration {
+  sw.mu.Lock()
+  defer sw.mu.Unlock()
+  if sw.running {
+    sw.elapsed += sw.clock.Now().Sub(sw.start)
+    sw.running = false
+  }
+  return sw.elapsed
+}
+
+// 停止计时并清空累计时间、Lap和Span
+func (sw *Stopwatch) Reset() {
+  sw.mu.Lock()
+  defer sw.mu.Unlock()
+  sw.running = false
+  sw.elapsed = 0
+  sw.lastLap = 0
+  sw.laps = nil
+  sw.spans = nil
+}
+
+// 记录一个Lap并返回与上一个Lap的间隔
+func (sw *Stopwatch) Lap(name string) time.Duration {
+  sw.mu.Lock()
+  defer sw.mu.Unlock()
+  total := sw.elapsedLocked()
+  lap := Lap{Name: name, Duration: total - sw.lastLap, Total: total}
+  sw.lastLap = total
+  sw.laps = append(sw.laps, lap)
+  return lap.Duration
+}
+
+// 累计的时间（计时中时包括到现在的时间）
+func (sw *Stopwatch) Elapsed() time.Duration {
+  sw.mu.Lock()
+  defer sw.mu.Unlock()
+  return sw.elapsedLocked()
+}
+
+func (sw *Stopwatch) elapsedLocked() time.Duration {
+  if sw.running {
+    return sw.elapsed + sw.clock.Now().Sub(sw.start)
+  }
+  return sw.elapsed
+}
+
+func (sw *Stopwatch) Running() bool {
+  sw.mu.Lock()
+  defer sw.mu.Unlock()
+  return sw.running
+}
+
+func (sw *Stopwatch) Laps() []Lap {
+  sw.mu.Lock()
+  defer sw.mu.Unlock()
+  ret := make([]Lap, len(sw.laps))
+  copy(ret, sw.laps)
+  return ret
+}
+
+// 创建并开始一个嵌套的子Span（使用相同的Clock），用Stop结束，
+// 父Stopwatch的时间包括所有子Span的时间
+func (sw *Stopwatch) Span(name string) *Stopwatch {
+  span := StartStopwatch(sw.clock, name)
+  sw.mu.Lock()
+  sw.spans = append(sw.spans, span)
+  sw.mu.Unlock()
+  return span
+}
+
+func (sw *Stopwatch) Spans() []*Stopwatch {
+  sw.mu.Lock()
+  defer sw.mu.Unlock()
+  ret := make([]*Stopwatch, len(sw.spans))
+  copy(ret, sw.spans)
+  return ret
+}
+
+// 以缩进的树状格式输出，如：
+//   request: 120ms
+//     - parse: 10ms
+//     query: 100ms
+//       sql: 80ms
+// 其中"- "开头的为Lap，其余的为Span，计时中的加"(running)"
+func (sw *Stopwatch) WriteTo(w io.Writer) (int64, error) {
+  var b strings.Builder
+  sw.write(&b, 0)
+  n, e := io.WriteString(w, b.String())
+  return int64(n), e
+}
+
+func (sw *Stopwatch) String() string {
+  var b strings.Builder
+  sw.write(&b, 0)
+  return b.String()
+}
+
+func (sw *Stopwatch) write(b *strings.Builder, depth int) {
+  sw.mu.Lock()
+  elapsed := sw.elapsedLocked()
+  running := sw.running
+  laps := sw.laps
+  spans := sw.spans
+  sw.mu.Unlock()
+  indent := strings.Repeat("  ", depth)
+  b.WriteString(indent + sw.Name + ": " + elapsed.String())
+  if running {
+    b.WriteString(" (running)")
+  }
+  b.WriteString("\n")
+  for _, lap := range laps {
+    b.WriteString(indent + "  - " + lap.Name + ": " + lap.Duration.String() + "\n")
+  }
+  for _, span := range spans {
+    span.write(b, depth+1)
+  }
+}
@@ -0,0 +1,41 @@
+package time2
+
+import (
+  "testing"
+  "time"
+)
+
+func TestStopwatch(t *testing.T) {
+  c := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+  sw := StartStopwatch(c, "request")
+  c.Advance(time.Millisecond * 10)
+  if d := sw.Lap("parse"); d != time.Millisecond*10 {
+    t.Errorf("got %s", d)
+  }
+  span := sw.Span("query")
+  c.Advance(time.Millisecond * 30)
+  span.Span("sql").Stop()
+  span.Stop()
+  if d := sw.Lap("query"); d != time.Millisecond*30 {
+    t.Errorf("got %s", d)
+  }
+  sw.Stop()
+  c.Advance(time.Second)
+  sw.Start()
+  c.Advance(time.Millisecond * 10)
+  if d := sw.Stop(); d != time.Millisecond*50 || sw.Running() {
+    t.Errorf("got %s", d)
+  }
+  laps := sw.Laps()
+  if len(laps) != 2 || laps[1].Total != time.Millisecond*40 {
+    t.Errorf("got %v", laps)
+  }
+  want := "request: 50ms\n  - parse: 10ms\n  - query: 30ms\n  query: 30ms\n    sql: 0s\n"
+  if s := sw.String(); s != want {
+    t.Errorf("got %q", s)
+  }
+  sw.Reset()
+  if sw.Elapsed() != 0 || len(sw.Laps()) != 0 || len(sw.Spans()) != 0 {
+    t.Error("not reset")
+  }
+}
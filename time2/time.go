@@ -9,6 +9,7 @@ const (
   DateFormat2 = "2006_01_02"
   DateFormat3 = "2006/01/02"
   DateFormat4 = "2006.01.02"
+  DateFormat5 = "20060102"
 
   TimeFormat    = "15:04"
   TimeFormatSec = "15:04:05"
@@ -34,7 +35,8 @@ const (
 )
 
 var (
-  TimeZoneSH, _ = time.LoadLocation("Asia/Shanghai")
+  // 没有时区数据时（见LoadLocation）为固定的+8，1991年之后中国没有夏令时，只有更早的时间不准确
+  TimeZoneSH = loadShanghai()
 
   Nil time.Time
 
@@ -50,6 +52,13 @@ func TimestampNano() int64 {
   return time.Now().UnixNano()
 }
 
+func loadShanghai() *time.Location {
+  if loc, e := LoadLocation("Asia/Shanghai"); e == nil {
+    return loc
+  }
+  return time.FixedZone("CST", 8*3600)
+}
+
 func Shanghai() time.Time {
   return time.Now().In(TimeZoneSH)
 }
@@ -1,102 +1,369 @@
 package time2
 
 import (
-  "math/rand"
+  "context"
+  "sort"
   "sync"
+  "sync/atomic"
   "time"
+  "unsafe"
 )
 
 const (
   ready = iota
   running
+  paused
   stopped
 )
 
 var DefaultTimingWheel = NewTimingWheel(60, time.Second)
 
+// 分层时间轮（hierarchical timing wheel），
+// 第0层每个slot为dps，第i层每个slot为第i-1层一轮的时间，
+// 例如60个slot、dps为1秒时，各层依次对应秒/分/时……，
+// 上层时间轮在有需要时才创建（overflow wheel），
+// task随时间推移从上层逐级降到第0层（cascade），
+// 因此每次tick只需处理到期或需要降级的task
 type TimingWheel struct {
   state int
 
-  ticker *time.Ticker
+  clock Clock
+
+  ticker Ticker
+
+  // 执行到期的task
+  executor Executor
+
+  metrics *metrics
+
+  observer Observer
 
   // 单个slot时间（duration per slot）
   dps time.Duration
 
-  // 当前slot
-  slot uint64
-  // 一轮有多少个slot
+  // 从启动到现在经过的tick数
+  ticks uint64
+
+  // 用于生成task id，见nextID
+  gen uint64
+  seq uint64
+  // 每层时间轮有多少个slot
   slots uint64
 
-  // 每个slot对应一个bucket，一轮共有len(buckets)个slot，
-  // 每个bucket是一个map，包含该slot的所有task
-  buckets []map[uint64]*task
+  // 各层时间轮，levels[0]精度最高
+  levels []*level
+
+  // 所有未执行的task，key为task id
+  tasks map[uint64]*task
+
+  // DelayCtx/AtCtx添加的还没完成的task，key为task id
+  handles map[uint64]*Handle
+
+  // 持久化task的日志，为nil表示不持久化
+  journal *Journal
+  // 重启后已经过期的task的处理方式
+  misfire int
+  // 可持久化task的处理函数，key为注册的名字
+  handlers map[string]func(uint64, interface{})
+
+  // 是否启用精确模式，见WithPrecision
+  precision bool
+  // 精确模式下允许提前执行的时间
+  tolerance time.Duration
+  // 精确模式下第0个tick对应的时间，第n个tick在origin+n*dps，
+  // 每次开始计时时调整，使停止/暂停的时间不计入
+  origin time.Time
+  // 没有在计时时时间轮停在的时间
+  frozen time.Time
+
+  // 不加锁取消的task（*task），通过task.cancelNext组成的无锁栈，
+  // 每次tick和停止计时时从时间轮中移除，见ShardedTimingWheel.Cancel
+  cancelled unsafe.Pointer
+
+  // 是否在计时（1表示在计时），不加锁读取，没有在计时时Cancel直接移除task
+  ticking int32
 
   // 计时器停止信号
   stopChan chan struct{}
+  // run退出时关闭
+  doneChan chan struct{}
 
   mu sync.Mutex
 }
 
-func NewTimingWheel(slots int, dps time.Duration) *TimingWheel {
-  if slots <= 0 || dps <= 0 {
-    return nil
+type Option func(*TimingWheel)
+
+// 指定时钟，默认为RealClock
+func WithClock(c Clock) Option {
+  return func(tw *TimingWheel) {
+    if c != nil {
+      tw.clock = c
+    }
   }
-  buckets := make([]map[uint64]*task, slots)
-  for i := range buckets {
-    buckets[i] = make(map[uint64]*task, 16)
+}
+
+// 指定执行到期task的Executor（如WorkerPool），
+// 默认每个task启动一个goroutine执行
+func WithExecutor(e Executor) Option {
+  return func(tw *TimingWheel) {
+    if e != nil {
+      tw.executor = e
+    }
+  }
+}
+
+// 精确模式，task在期望执行时间前后tolerance之内执行（最多提前tolerance），
+// 默认模式下task到期的时间按slot取整（至少多等一个slot），ticker的误差也会累积，
+// 精确模式下task记录绝对的执行时间，tick根据时钟计算（GC等导致的漏掉的tick会补上），
+// task所在的slot到期后再按剩余时间单独计时，
+// 代价是每个需要单独计时的task会多一个goroutine和timer，
+// tolerance越大，需要单独计时的task越少
+func WithPrecision(tolerance time.Duration) Option {
+  return func(tw *TimingWheel) {
+    if tolerance < 0 {
+      tolerance = 0
+    }
+    tw.precision = true
+    tw.tolerance = tolerance
   }
-  return &TimingWheel{
+}
+
+// slots为每层的slot数量，必须大于1（每层的跨度是下一层的slots倍），
+// dps为最底层每个slot的时长，必须大于0，参数不合法时返回nil
+func NewTimingWheel(slots int, dps time.Duration, opts ...Option) *TimingWheel {
+  if slots <= 1 || dps <= 0 {
+    return nil
+  }
+  tw := &TimingWheel{
     state:    ready,
-    ticker:   time.NewTicker(dps),
+    clock:    RealClock,
+    executor: newGoExecutor(),
+    metrics:  newMetrics(),
     dps:      dps,
-    slot:     0,
+    ticks:    0,
     slots:    uint64(slots),
-    buckets:  buckets,
-    stopChan: make(chan struct{}),
+    tasks:    make(map[uint64]*task, 64),
+    handles:  make(map[uint64]*Handle, 16),
+    handlers: make(map[string]func(uint64, interface{}), 8),
     mu:       sync.Mutex{},
   }
+  tw.levels = []*level{newLevel(1, tw.slots)}
+  for _, opt := range opts {
+    opt(tw)
+  }
+  tw.origin = tw.clock.Now()
+  tw.frozen = tw.origin
+  return tw
 }
 
+// 启动时间轮，停止（Stop）之后可以再次启动，
+// 停止期间时间轮不走动，之前没执行的task在再次启动后继续计时
 func (tw *TimingWheel) Start() {
   tw.mu.Lock()
   defer tw.mu.Unlock()
-  if tw.state == ready {
-    tw.state = running
-    go tw.run()
+  restart := false
+  switch tw.state {
+  case ready:
+    if tw.journal != nil {
+      tw.replay()
+    }
+  case stopped:
+    restart = true
+  default:
+    return
+  }
+  tw.nextGen()
+  tw.startTicking()
+  if restart {
+    tw.syncJournal()
   }
 }
 
+// 停止计时，不会执行已经提交给Executor的task，
+// 所有DelayCtx/AtCtx添加的task都会被取消（正在执行的通过context通知）
 func (tw *TimingWheel) Stop() {
+  tw.mu.Lock()
+  defer tw.mu.Unlock()
+  tw.stop()
+}
+
+func (tw *TimingWheel) stop() {
+  switch tw.state {
+  case running:
+    tw.stopTicking()
+  case paused:
+  default:
+    return
+  }
+  tw.state = stopped
+  for id, h := range tw.handles {
+    if t, ok := tw.tasks[id]; ok {
+      tw.remove(t)
+      tw.cancelHandle(id)
+    } else {
+      h.cancel()
+    }
+  }
+}
+
+// 停止并等待已经提交给Executor的task执行完，
+// 不能在task中调用（会一直等待自己执行完）
+func (tw *TimingWheel) StopAndWait() {
+  tw.mu.Lock()
+  tw.stop()
+  done := tw.doneChan
+  tw.mu.Unlock()
+  if done != nil {
+    <-done
+  }
+  tw.executor.Wait()
+}
+
+// 停止时间轮，已经到期（执行时间已过）但还没执行的task会立即提交执行，
+// 其余还没执行的task从时间轮中移除并返回，
+// 然后等待已经提交的task执行完，ctx结束时不再等待并返回ctx.Err()，
+// 返回之后时间轮中没有任何task，可以再次Start，
+// 持久化的task仍然保留在日志中
+func (tw *TimingWheel) Shutdown(ctx context.Context) ([]TaskInfo, error) {
+  tw.mu.Lock()
+  tw.stop()
+  done := tw.doneChan
+  now := tw.now()
+  due := make([]dueTask, 0, 16)
+  unfired := make([]TaskInfo, 0, len(tw.tasks))
+  for _, t := range tw.tasks {
+    if !t.queued && !t.waiting {
+      // FixedDelay的task正在执行，执行完后不再安排
+      delete(tw.tasks, t.id)
+      continue
+    }
+    tw.remove(t)
+    if atomic.LoadInt32(&t.state) == taskCancelled {
+      continue
+    }
+    if t.deadline.After(now) {
+      unfired = append(unfired, t.info(tw.period(t)))
+    } else {
+      t.interval = 0
+      if tw.claim(t) {
+        due = append(due, newDueTask(t))
+      }
+    }
+  }
+  tw.mu.Unlock()
+  sort.Slice(unfired, func(i, j int) bool {
+    return unfired[i].Deadline.Before(unfired[j].Deadline)
+  })
+  if done != nil {
+    <-done
+  }
+  for _, d := range due {
+    tw.dispatch(d)
+  }
+  waitChan := make(chan struct{})
+  go func() {
+    tw.executor.Wait()
+    close(waitChan)
+  }()
+  if ctx == nil {
+    ctx = context.Background()
+  }
+  select {
+  case <-waitChan:
+    return unfired, nil
+  case <-ctx.Done():
+    return unfired, ctx.Err()
+  }
+}
+
+// 暂停计时，暂停期间task不会到期，Resume之后继续计时
+func (tw *TimingWheel) Pause() {
   tw.mu.Lock()
   defer tw.mu.Unlock()
   if tw.state == running {
-    tw.state = stopped
-    close(tw.stopChan)
+    tw.stopTicking()
+    tw.state = paused
+  }
+}
+
+func (tw *TimingWheel) Resume() {
+  tw.mu.Lock()
+  defer tw.mu.Unlock()
+  if tw.state == paused {
+    tw.startTicking()
+    tw.syncJournal()
   }
 }
 
+func (tw *TimingWheel) startTicking() {
+  tw.state = running
+  atomic.StoreInt32(&tw.ticking, 1)
+  tw.stopChan = make(chan struct{})
+  tw.doneChan = make(chan struct{})
+  // 停止期间的时间不计入，所有tick和task的执行时间都推迟相应的时间，
+  // 普通模式下task按tick到期，也需要推迟deadline，否则Remaining/Extend/Shutdown会按墙上时间计算
+  shift := tw.clock.Now().Sub(tw.frozen)
+  tw.origin = tw.origin.Add(shift)
+  for _, t := range tw.tasks {
+    t.deadline = t.deadline.Add(shift)
+    if t.waiting {
+      tw.wait(t)
+    }
+  }
+  if tw.precision {
+    tw.ticker = newAlignedTicker(tw.clock, tw.origin.Add(time.Duration(tw.ticks+1)*tw.dps), tw.dps)
+  } else {
+    tw.ticker = tw.clock.NewTicker(tw.dps)
+  }
+  go tw.run(tw.ticker, tw.stopChan, tw.doneChan)
+}
+
+func (tw *TimingWheel) stopTicking() {
+  close(tw.stopChan)
+  tw.ticker.Stop()
+  tw.frozen = tw.clock.Now()
+  atomic.StoreInt32(&tw.ticking, 0)
+  // 停止期间不会tick，先移除已经取消的task
+  tw.purge()
+}
+
 func (tw *TimingWheel) Delay(delay time.Duration, data interface{}, f func(uint64, interface{})) uint64 {
   if delay <= 0 || f == nil {
     return 0
   }
-  // 剩余轮数
-  n1 := uint64(delay/tw.dps) / tw.slots
-  // 需要几个slot的时间
-  n2 := uint64(delay/tw.dps) % tw.slots
-  if n2 == 0 {
-    // 不足一个slot时间，按一个slot时间算
-    n2 = 1
+  tw.mu.Lock()
+  defer tw.mu.Unlock()
+  task := tw.newTask(delay, data, f)
+  tw.insert(task)
+  return task.id
+}
+
+// 以FixedRate模式每隔interval执行一次f，直到被Cancel
+func (tw *TimingWheel) Every(interval time.Duration, data interface{}, f func(uint64, interface{})) uint64 {
+  return tw.Repeat(interval, nil, data, f)
+}
+
+// 每隔interval执行一次f，opt为nil时等同于Every，
+// 每次执行时传给f的id都是同一个，可以随时用这个id取消
+func (tw *TimingWheel) Repeat(interval time.Duration, opt *RepeatOption, data interface{}, f func(uint64, interface{})) uint64 {
+  if interval <= 0 || f == nil {
+    return 0
+  }
+  if opt == nil {
+    opt = &RepeatOption{}
+  }
+  if !opt.Until.IsZero() && !opt.Until.After(tw.clock.Now().Add(interval)) {
+    return 0
   }
   tw.mu.Lock()
   defer tw.mu.Unlock()
-  n := (tw.slot + n2 + 1) % tw.slots
-  task := &task{
-    id:    (n << 32) | (rand.Uint64() >> 32),
-    round: n1,
-    data:  data,
-    f:     f,
-  }
-  tw.buckets[n][task.id] = task
+  task := tw.newTask(interval, data, f)
+  task.interval = tw.toTicks(interval)
+  task.period = interval
+  task.mode = opt.Mode
+  task.maxRuns = opt.MaxRuns
+  task.until = opt.Until
+  tw.insert(task)
   return task.id
 }
 
@@ -104,64 +371,620 @@ func (tw *TimingWheel) At(t time.Time, data interface{}, f func(uint64, interfac
   if f == nil {
     return 0
   }
-  if now := UTC(); t.After(now) {
+  if now := tw.clock.Now(); t.After(now) {
     return tw.Delay(t.Sub(now), data, f)
   }
   return 0
 }
 
-func (tw *TimingWheel) Cancel(id uint64) {
-  i := id >> 32
-  if i < tw.slots {
+// 取消task，返回是否真的移除了一个还没执行的task，
+// 已经执行完、已经取消或不存在的id返回false
+func (tw *TimingWheel) Cancel(id uint64) bool {
+  tw.mu.Lock()
+  t, ok := tw.tasks[id]
+  if ok {
+    tw.remove(t)
+    tw.cancelHandle(id)
+    // 在锁内写日志，保证日志中的顺序与时间轮中的一致
+    if tw.journal != nil {
+      tw.journalError(id, tw.journal.remove(id))
+    }
+  }
+  tw.mu.Unlock()
+  if !ok {
+    return false
+  }
+  tw.metrics.cancel()
+  if tw.observer != nil {
+    tw.observer.OnCancel(id)
+  }
+  return true
+}
+
+// 重新设置task的执行时间为delay之后，id保持不变，
+// task不存在、已经开始执行（FixedDelay的task正在执行）时返回false，
+// 重复执行的task只影响下一次执行时间
+func (tw *TimingWheel) Reset(id uint64, delay time.Duration) bool {
+  if delay <= 0 {
+    return false
+  }
+  tw.mu.Lock()
+  defer tw.mu.Unlock()
+  t, ok := tw.tasks[id]
+  if !ok || !t.queued && !t.waiting {
+    return false
+  }
+  tw.resetLocked(t, delay)
+  return true
+}
+
+// 把t重新安排到delay之后（需要持有锁）
+func (tw *TimingWheel) resetLocked(t *task, delay time.Duration) {
+  tw.unlink(t)
+  t.exp = tw.expiration(delay)
+  t.deadline = tw.now().Add(delay)
+  tw.place(t)
+  if tw.journal != nil {
+    tw.journalError(t.id, tw.journal.reset(t.id, t.deadline))
+  }
+}
+
+// 把task的执行时间推迟d（d为负数时提前），
+// 与Reset一样，task不存在或已经开始执行时返回false，
+// 查找和重新安排在同一次加锁中完成，并发调用时每次推迟都会生效
+func (tw *TimingWheel) Extend(id uint64, d time.Duration) bool {
+  tw.mu.Lock()
+  defer tw.mu.Unlock()
+  t, ok := tw.tasks[id]
+  if !ok || !t.queued && !t.waiting {
+    return false
+  }
+  delay := t.deadline.Add(d).Sub(tw.now())
+  if delay <= 0 {
+    // 已经过了新的执行时间，尽快执行
+    delay = time.Nanosecond
+  }
+  tw.resetLocked(t, delay)
+  return true
+}
+
+// task是否还没执行（重复执行的task在Cancel或执行完最后一次之前都存在）
+func (tw *TimingWheel) Exists(id uint64) bool {
+  tw.mu.Lock()
+  defer tw.mu.Unlock()
+  _, ok := tw.tasks[id]
+  return ok
+}
+
+// 距离task下一次执行还有多久，task不存在时返回false
+func (tw *TimingWheel) Remaining(id uint64) (time.Duration, bool) {
+  tw.mu.Lock()
+  defer tw.mu.Unlock()
+  t, ok := tw.tasks[id]
+  if !ok {
+    return 0, false
+  }
+  d := t.deadline.Sub(tw.now())
+  if d < 0 {
+    d = 0
+  }
+  return d, true
+}
+
+// 所有还没执行的task，按执行时间排序
+func (tw *TimingWheel) Pending() []TaskInfo {
+  tw.mu.Lock()
+  ret := make([]TaskInfo, 0, len(tw.tasks))
+  for _, t := range tw.tasks {
+    ret = append(ret, t.info(tw.period(t)))
+  }
+  tw.mu.Unlock()
+  sort.Slice(ret, func(i, j int) bool {
+    return ret[i].Deadline.Before(ret[j].Deadline)
+  })
+  return ret
+}
+
+// 添加新的task
+func (tw *TimingWheel) insert(t *task) {
+  tw.tasks[t.id] = t
+  tw.place(t)
+  tw.metrics.schedule()
+  if tw.observer != nil {
+    tw.observer.OnSchedule(t.id, t.deadline)
+  }
+}
+
+func (tw *TimingWheel) remove(t *task) {
+  tw.unlink(t)
+  delete(tw.tasks, t.id)
+}
+
+// 从bucket中移除（或停止单独计时）
+func (tw *TimingWheel) unlink(t *task) {
+  if t.queued {
+    delete(tw.levels[t.level].buckets[t.slot], t.id)
+    t.queued = false
+  }
+  t.waiting = false
+}
+
+// 把task放到时间轮中，
+// 精确模式下根据执行时间计算到期的tick，已经过了该tick时单独计时
+func (tw *TimingWheel) place(t *task) {
+  if !tw.precision {
+    tw.add(t)
+    return
+  }
+  t.exp = tw.tickAt(t.deadline)
+  if !tw.add(t) {
+    tw.wait(t)
+  }
+}
+
+// 精确模式下，task所在的tick已经到了但还没到执行时间，
+// 单独计时到执行时间后再执行，时间轮没有在计时时等到开始计时（startTicking）再计时
+func (tw *TimingWheel) wait(t *task) {
+  t.waiting = true
+  t.token++
+  if tw.state != running {
+    return
+  }
+  token := t.token
+  stopChan := tw.stopChan
+  // 在持有锁时开始计时，否则goroutine开始运行前时钟已经走过的时间会被多等一次
+  var after <-chan time.Time
+  if d := t.deadline.Sub(tw.clock.Now()); d > tw.tolerance {
+    after = tw.clock.After(d)
+  }
+  go func() {
+    if after != nil {
+      select {
+      case <-after:
+      case <-stopChan:
+        return
+      }
+    }
     tw.mu.Lock()
-    defer tw.mu.Unlock()
-    delete(tw.buckets[i], id)
+    // 计时期间可能已经取消、Reset或停止了
+    if tw.tasks[t.id] != t || !t.waiting || t.token != token || tw.state != running {
+      tw.mu.Unlock()
+      return
+    }
+    t.waiting = false
+    if !tw.claim(t) {
+      delete(tw.tasks, t.id)
+      tw.mu.Unlock()
+      return
+    }
+    due := newDueTask(t)
+    tw.expire(t)
+    tw.mu.Unlock()
+    tw.dispatch(due)
+  }()
+}
+
+// 时间轮当前的时间，没有在计时时为停止计时的时间
+func (tw *TimingWheel) now() time.Time {
+  if tw.state != running {
+    return tw.frozen
+  }
+  return tw.clock.Now()
+}
+
+// 精确模式下t所在的tick（t之前最近的一个tick）
+func (tw *TimingWheel) tickAt(t time.Time) uint64 {
+  d := t.Sub(tw.origin)
+  if d < 0 {
+    return 0
   }
+  return uint64(d / tw.dps)
 }
 
-func (tw *TimingWheel) run() {
+func (tw *TimingWheel) run(ticker Ticker, stopChan, doneChan chan struct{}) {
+  defer close(doneChan)
   for {
     select {
-    case <-tw.stopChan:
-      tw.ticker.Stop()
+    case <-stopChan:
       return
 
-    case <-tw.ticker.C:
+    case <-ticker.C():
       tw.mu.Lock()
-      if tw.slot == tw.slots-1 {
-        tw.slot = 0
+      // 等待锁期间可能已经停止或暂停了
+      select {
+      case <-stopChan:
+        tw.mu.Unlock()
+        return
+      default:
+      }
+      start := time.Now()
+      tw.purge()
+      var tasks []dueTask
+      if tw.precision {
+        // 根据时钟计算应该到哪个tick，补上漏掉的tick，
+        // ticker的误差不会累积
+        for target := tw.tickAt(tw.clock.Now()); tw.ticks < target; {
+          tasks = append(tasks, tw.tick()...)
+        }
       } else {
-        tw.slot++
+        tasks = tw.tick()
       }
-      tw.tick()
+      elapsed := time.Since(start)
       tw.mu.Unlock()
+      tw.metrics.tick(elapsed, len(tasks))
+      if tw.observer != nil {
+        tw.observer.OnTick(elapsed, len(tasks))
+      }
+      // 释放锁之后再提交，task中可以调用TimingWheel的方法，
+      // Executor阻塞时（如OverflowBlock）会推迟后续的tick
+      for _, d := range tasks {
+        tw.dispatch(d)
+      }
     }
   }
 }
 
-func (tw *TimingWheel) tick() {
+// 返回到期的task
+func (tw *TimingWheel) tick() []dueTask {
+  tw.ticks++
   tasks := make([]*task, 0, 16)
-  for _, t := range tw.buckets[tw.slot] {
-    if t.round > 0 {
-      t.round--
-    } else {
-      tasks = append(tasks, t)
+  // 从上往下降级，上层降下来的task可能落到下层本次要处理的bucket之外，
+  // 但不会落到下层本次正在处理的bucket中
+  for i := len(tw.levels) - 1; i > 0; i-- {
+    l := tw.levels[i]
+    if tw.ticks%l.span != 0 {
+      continue
     }
+    bucket := l.buckets[(tw.ticks/l.span)%tw.slots]
+    for _, t := range bucket {
+      tw.unlink(t)
+      if !tw.add(t) {
+        tasks = append(tasks, t)
+      }
+    }
+  }
+  bucket := tw.levels[0].buckets[tw.ticks%tw.slots]
+  for _, t := range bucket {
+    tw.unlink(t)
+    tasks = append(tasks, t)
+  }
+  ret := make([]dueTask, 0, len(tasks))
+  var now time.Time
+  if tw.precision {
+    now = tw.clock.Now()
   }
   for _, t := range tasks {
-    delete(tw.buckets[tw.slot], t.id)
-    go t.f(t.id, t.data)
+    if atomic.LoadInt32(&t.state) == taskCancelled {
+      delete(tw.tasks, t.id)
+      continue
+    }
+    if tw.precision && t.deadline.Sub(now) > tw.tolerance {
+      tw.wait(t)
+      continue
+    }
+    if !tw.claim(t) {
+      delete(tw.tasks, t.id)
+      continue
+    }
+    ret = append(ret, newDueTask(t))
+    tw.expire(t)
+  }
+  return ret
+}
+
+// 把不加锁取消的task放到cancelled中，等下次tick时移除
+func (tw *TimingWheel) pushCancelled(t *task) {
+  for {
+    head := atomic.LoadPointer(&tw.cancelled)
+    t.cancelNext = (*task)(head)
+    if atomic.CompareAndSwapPointer(&tw.cancelled, head, unsafe.Pointer(t)) {
+      return
+    }
+  }
+}
+
+// 移除cancelled中的task（需要持有锁）
+func (tw *TimingWheel) purge() {
+  for t := (*task)(atomic.SwapPointer(&tw.cancelled, nil)); t != nil; t = t.cancelNext {
+    if tw.tasks[t.id] == t {
+      tw.remove(t)
+    }
+  }
+}
+
+// 到期的task执行前调用（需要持有锁），返回false表示已经被取消（见ShardedTimingWheel.Cancel），
+// 只执行一次的task在这里标记为已执行，之后就不能再取消了
+func (tw *TimingWheel) claim(t *task) bool {
+  if t.interval == 0 {
+    return atomic.CompareAndSwapInt32(&t.state, taskPending, taskFired)
+  }
+  return atomic.LoadInt32(&t.state) != taskCancelled
+}
+
+// task到期时更新状态，重复执行的task（FixedRate）安排下一次
+func (tw *TimingWheel) expire(t *task) {
+  if t.interval == 0 {
+    delete(tw.tasks, t.id)
+    return
+  }
+  t.runs++
+  if t.mode == FixedDelay {
+    // 执行期间task仍在tw.tasks中（但不在任何bucket中），Cancel依然有效
+    return
+  }
+  if tw.hasNext(t) {
+    t.exp += t.interval
+    t.deadline = t.deadline.Add(tw.period(t))
+    tw.place(t)
+  } else {
+    delete(tw.tasks, t.id)
+  }
+}
+
+func (tw *TimingWheel) dispatch(d dueTask) {
+  t := d.t
+  run := func() {
+    lag := tw.clock.Now().Sub(d.deadline)
+    tw.metrics.fire(lag)
+    if tw.observer != nil {
+      tw.observer.OnFire(t.id, lag)
+    }
+    t.f(t.id, t.data)
+  }
+  if !d.fixedDelay {
+    tw.executor.Execute(run)
+    return
+  }
+  ok := tw.executor.Execute(func() {
+    defer tw.reschedule(t)
+    run()
+  })
+  if !ok {
+    tw.reschedule(t)
+  }
+}
+
+// FixedDelay的task执行完后安排下一次
+func (tw *TimingWheel) reschedule(t *task) {
+  tw.mu.Lock()
+  defer tw.mu.Unlock()
+  if tw.tasks[t.id] != t {
+    return
+  }
+  if tw.hasNext(t) {
+    t.exp = tw.ticks + t.interval + 1
+    t.deadline = tw.now().Add(tw.period(t))
+    tw.place(t)
+  } else {
+    delete(tw.tasks, t.id)
+  }
+}
+
+// 重复执行的task执行完本次后是否还需要再执行
+func (tw *TimingWheel) hasNext(t *task) bool {
+  if t.maxRuns > 0 && t.runs >= t.maxRuns {
+    return false
+  }
+  return t.until.IsZero() || t.until.After(tw.now().Add(tw.period(t)))
+}
+
+// 重复执行的间隔，精确模式下为Repeat指定的间隔，默认按slot取整
+func (tw *TimingWheel) period(t *task) time.Duration {
+  if tw.precision {
+    return t.period
+  }
+  return time.Duration(t.interval) * tw.dps
+}
+
+// 使用指定的id添加task，返回添加的task（ShardedTimingWheel使用）
+func (tw *TimingWheel) delayWithID(id uint64, delay time.Duration, data interface{}, f func(uint64, interface{})) *task {
+  tw.mu.Lock()
+  defer tw.mu.Unlock()
+  task := tw.newTask(delay, data, f)
+  task.id = id
+  tw.insert(task)
+  return task
+}
+
+func (tw *TimingWheel) newTask(delay time.Duration, data interface{}, f func(uint64, interface{})) *task {
+  exp := tw.expiration(delay)
+  return &task{
+    id:       tw.nextID(),
+    exp:      exp,
+    deadline: tw.now().Add(delay),
+    data:     data,
+    f:        f,
+  }
+}
+
+// task id的高16位为generation，低48位为递增序列，
+// generation在每次Start时加1（启用持久化时从日志中最大的generation之后开始），
+// 因此id在时间轮的整个生命周期内（包括重启进程后从日志恢复的task）都不会重复，
+// 也不会误删其他task
+func (tw *TimingWheel) nextID() uint64 {
+  tw.seq++
+  if tw.seq > seqMask {
+    tw.nextGen()
+    tw.seq = 1
+  }
+  return tw.gen<<seqBits | tw.seq
+}
+
+func (tw *TimingWheel) nextGen() {
+  tw.gen = (tw.gen + 1) & genMask
+}
+
+// 延迟delay后到期的tick
+func (tw *TimingWheel) expiration(delay time.Duration) uint64 {
+  // 当前slot已经过去了多久是未知的，多加一个slot保证不会提前执行
+  return tw.ticks + tw.toTicks(delay) + 1
+}
+
+// 需要几个slot的时间
+func (tw *TimingWheel) toTicks(d time.Duration) uint64 {
+  n := uint64(d / tw.dps)
+  if n == 0 {
+    // 不足一个slot时间，按一个slot时间算
+    n = 1
+  }
+  return n
+}
+
+// 把task放到合适的层和slot，task已到期返回false
+func (tw *TimingWheel) add(t *task) bool {
+  if t.exp <= tw.ticks {
+    return false
+  }
+  delta := t.exp - tw.ticks
+  i := 0
+  span := uint64(1)
+  // 剩余tick数超过当前层一轮的时间就放到上一层，
+  // span*slots溢出时说明已经是最上层了
+  for span <= maxUint64/tw.slots && delta >= span*tw.slots {
+    i++
+    span *= tw.slots
+    if i == len(tw.levels) {
+      tw.levels = append(tw.levels, newLevel(span, tw.slots))
+    }
+  }
+  t.level = i
+  t.slot = (t.exp / span) % tw.slots
+  t.queued = true
+  tw.levels[i].buckets[t.slot][t.id] = t
+  return true
+}
+
+const maxUint64 = ^uint64(0)
+
+// task.state
+const (
+  taskPending = iota
+  taskFired
+  taskCancelled
+)
+
+const (
+  seqBits = 48
+  seqMask = 1<<seqBits - 1
+  genMask = 1<<(64-seqBits) - 1
+)
+
+// task的快照
+type TaskInfo struct {
+  ID uint64
+
+  // 下一次执行时间
+  Deadline time.Time
+
+  Data interface{}
+
+  // 重复执行的间隔，只执行一次的task为0
+  Interval time.Duration
+
+  // 已经执行的次数（只对重复执行的task有意义）
+  Runs int
+}
+
+const (
+  // 固定频率，到期后立即安排下一次，不等待f执行完
+  FixedRate = iota
+  // 固定间隔，f执行完后再间隔interval安排下一次
+  FixedDelay
+)
+
+type RepeatOption struct {
+  // FixedRate或FixedDelay
+  Mode int
+
+  // 最多执行多少次，<=0表示不限
+  MaxRuns int
+
+  // 下一次执行时间晚于Until就不再执行，零值表示不限
+  Until time.Time
+}
+
+type level struct {
+  // 该层每个slot包含的tick数
+  span uint64
+
+  // 每个slot对应一个bucket，
+  // 每个bucket是一个map，包含该slot的所有task
+  buckets []map[uint64]*task
+}
+
+func newLevel(span, slots uint64) *level {
+  buckets := make([]map[uint64]*task, slots)
+  for i := range buckets {
+    buckets[i] = make(map[uint64]*task, 16)
+  }
+  return &level{span: span, buckets: buckets}
+}
+
+func (t *task) info(interval time.Duration) TaskInfo {
+  return TaskInfo{
+    ID:       t.id,
+    Deadline: t.deadline,
+    Data:     t.data,
+    Interval: interval,
+    Runs:     t.runs,
+  }
+}
+
+// 到期的task，在持有锁时生成，提交给Executor时不需要再读取task中会变化的字段
+type dueTask struct {
+  t *task
+
+  // 本次期望的执行时间
+  deadline time.Time
+
+  // 是否需要在执行完后安排下一次
+  fixedDelay bool
+}
+
+func newDueTask(t *task) dueTask {
+  return dueTask{
+    t:          t,
+    deadline:   t.deadline,
+    fixedDelay: t.interval > 0 && t.mode == FixedDelay,
   }
 }
 
 type task struct {
-  // 高32位表示task所在的slot，低32位随机生成
+  // 见nextID
   id uint64
 
-  // 剩余轮数
-  round uint64
+  // taskPending/taskFired/taskCancelled，原子操作，
+  // 只有ShardedTimingWheel会在不持有锁的情况下把task标记为已取消
+  state int32
+
+  // 见TimingWheel.cancelled
+  cancelNext *task
+
+  // 到期的tick
+  exp uint64
+
+  // 期望的执行时间
+  deadline time.Time
+
+  // 所在的层和slot，queued为false表示不在任何bucket中（已到期）
+  level  int
+  slot   uint64
+  queued bool
+
+  // 精确模式下是否正在单独计时（见wait），token用于识别过期的计时
+  waiting bool
+  token   uint64
 
   data interface{}
 
   f func(uint64, interface{})
+
+  // 重复执行的间隔tick数，0表示只执行一次
+  interval uint64
+  period   time.Duration
+  mode     int
+  maxRuns  int
+  runs     int
+  until    time.Time
 }
+
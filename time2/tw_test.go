@@ -1,120 +1,801 @@
 package time2
 
 import (
-  "fmt"
+  "bytes"
+  "context"
+  "io/ioutil"
   "math/rand"
+  "os"
+  "path/filepath"
+  "strings"
   "sync"
   "testing"
   "time"
 )
 
+func newFakeTimingWheel(slots int, dps time.Duration) (*TimingWheel, *FakeClock) {
+  clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+  tw := NewTimingWheel(slots, dps, WithClock(clock))
+  tw.Start()
+  return tw, clock
+}
+
+// 返回的f在执行时检查是否提前执行了
+func expectAfter(t *testing.T, clock *FakeClock, wg *sync.WaitGroup, delay time.Duration) func(uint64, interface{}) {
+  start := clock.Now()
+  return func(id uint64, data interface{}) {
+    defer wg.Done()
+    if e := clock.Now().Sub(start); e < delay {
+      t.Errorf("task %d(%v): delay %v, fired after %v", id, data, delay, e)
+    }
+  }
+}
+
+// 每次推进step，直到wg完成，
+// 推进了max之后wg还没完成说明有task没有按时执行
+func advanceUntil(t *testing.T, clock *FakeClock, step, max time.Duration, wg *sync.WaitGroup) {
+  advanceWaitUntil(t, nil, clock, step, max, wg)
+}
+
+// 与advanceUntil相同，tw不为nil时每次推进后等待已经提交的task执行完（包括FixedDelay的重新安排），
+// 推进下一步时时间轮已经收到了上一个tick（FakeClock的Advance会阻塞到tick被接收），
+// 所以每个tick提交的task最晚在再推进一步之后执行完，不会在task重新安排之前就用完max
+func advanceWaitUntil(t *testing.T, tw *TimingWheel, clock *FakeClock, step, max time.Duration, wg *sync.WaitGroup) {
+  done := make(chan struct{})
+  go func() {
+    wg.Wait()
+    close(done)
+  }()
+  for d := time.Duration(0); d < max; d += step {
+    select {
+    case <-done:
+      return
+    default:
+      clock.Advance(step)
+      if tw != nil {
+        tw.executor.Wait()
+      }
+    }
+  }
+  select {
+  case <-done:
+  case <-time.After(time.Second * 5):
+    t.Fatalf("tasks not fired after %v", max)
+  }
+}
+
 func TestNormal(t *testing.T) {
+  tw, clock := newFakeTimingWheel(60, time.Second)
+  defer tw.Stop()
   var wg sync.WaitGroup
   wg.Add(3)
-  DefaultTimingWheel.Start()
-  DefaultTimingWheel.Delay(time.Second*10, "data1", func(id uint64, data interface{}) {
-    fmt.Printf("executing task %d: %v\n", id, data)
-    wg.Done()
-  })
-  time.Sleep(time.Second * 5)
-  DefaultTimingWheel.Delay(time.Second*8, "data2", func(id uint64, data interface{}) {
-    fmt.Printf("executing task %d: %v\n", id, data)
-    wg.Done()
-  })
-  DefaultTimingWheel.Delay(time.Millisecond*200, "data3", func(id uint64, data interface{}) {
-    fmt.Printf("executing task %d: %v\n", id, data)
-    wg.Done()
-  })
-  wg.Wait()
+  tw.Delay(time.Second*10, "data1", expectAfter(t, clock, &wg, time.Second*10))
+  clock.Advance(time.Second * 5)
+  tw.Delay(time.Second*8, "data2", expectAfter(t, clock, &wg, time.Second*8))
+  tw.Delay(time.Millisecond*200, "data3", expectAfter(t, clock, &wg, time.Millisecond*200))
+  advanceUntil(t, clock, time.Second, time.Second*9, &wg)
 }
 
 func TestCritical1(t *testing.T) {
+  tw, clock := newFakeTimingWheel(60, time.Second)
+  defer tw.Stop()
   var wg sync.WaitGroup
   wg.Add(3)
-  DefaultTimingWheel.Start()
-  DefaultTimingWheel.Delay(time.Second*59, "data1", func(id uint64, data interface{}) {
-    fmt.Printf("executing task %d: %v\n", id, data)
-    wg.Done()
-  })
-  time.Sleep(time.Second * 5)
-  DefaultTimingWheel.Delay(time.Second*59, "data2", func(id uint64, data interface{}) {
-    fmt.Printf("executing task %d: %v\n", id, data)
-    wg.Done()
-  })
-  DefaultTimingWheel.Delay(time.Millisecond*100, "data3", func(id uint64, data interface{}) {
-    fmt.Printf("executing task %d: %v\n", id, data)
-    wg.Done()
-  })
-  wg.Wait()
+  tw.Delay(time.Second*59, "data1", expectAfter(t, clock, &wg, time.Second*59))
+  clock.Advance(time.Second * 5)
+  tw.Delay(time.Second*59, "data2", expectAfter(t, clock, &wg, time.Second*59))
+  tw.Delay(time.Millisecond*100, "data3", expectAfter(t, clock, &wg, time.Millisecond*100))
+  advanceUntil(t, clock, time.Second, time.Second*60, &wg)
 }
 
 func TestCritical2(t *testing.T) {
+  tw, clock := newFakeTimingWheel(60, time.Second)
+  defer tw.Stop()
   var wg sync.WaitGroup
   wg.Add(3)
-  DefaultTimingWheel.Start()
-  DefaultTimingWheel.Delay(time.Second*60, "data1", func(id uint64, data interface{}) {
-    fmt.Printf("executing task %d: %v\n", id, data)
-    wg.Done()
-  })
-  time.Sleep(time.Millisecond * 8500)
-  DefaultTimingWheel.Delay(time.Second*60, "data2", func(id uint64, data interface{}) {
-    fmt.Printf("executing task %d: %v\n", id, data)
-    wg.Done()
-  })
-  DefaultTimingWheel.Delay(time.Millisecond*500, "data3", func(id uint64, data interface{}) {
-    fmt.Printf("executing task %d: %v\n", id, data)
-    wg.Done()
-  })
-  wg.Wait()
+  tw.Delay(time.Second*60, "data1", expectAfter(t, clock, &wg, time.Second*60))
+  clock.Advance(time.Millisecond * 8500)
+  tw.Delay(time.Second*60, "data2", expectAfter(t, clock, &wg, time.Second*60))
+  tw.Delay(time.Millisecond*500, "data3", expectAfter(t, clock, &wg, time.Millisecond*500))
+  advanceUntil(t, clock, time.Millisecond*500, time.Millisecond*60500, &wg)
 }
 
 func TestCritical3(t *testing.T) {
+  tw, clock := newFakeTimingWheel(60, time.Second)
+  defer tw.Stop()
   var wg sync.WaitGroup
   wg.Add(3)
-  DefaultTimingWheel.Start()
-  DefaultTimingWheel.Delay(time.Second*61, "data1", func(id uint64, data interface{}) {
-    fmt.Printf("executing task %d: %v\n", id, data)
-    wg.Done()
-  })
-  time.Sleep(time.Millisecond * 3765)
-  DefaultTimingWheel.Delay(time.Second*61, "data2", func(id uint64, data interface{}) {
-    fmt.Printf("executing task %d: %v\n", id, data)
-    wg.Done()
-  })
-  DefaultTimingWheel.Delay(time.Millisecond*1000, "data3", func(id uint64, data interface{}) {
-    fmt.Printf("executing task %d: %v\n", id, data)
-    wg.Done()
-  })
-  wg.Wait()
+  tw.Delay(time.Second*61, "data1", expectAfter(t, clock, &wg, time.Second*61))
+  clock.Advance(time.Millisecond * 3765)
+  tw.Delay(time.Second*61, "data2", expectAfter(t, clock, &wg, time.Second*61))
+  tw.Delay(time.Millisecond*1000, "data3", expectAfter(t, clock, &wg, time.Millisecond*1000))
+  advanceUntil(t, clock, time.Millisecond*235, time.Millisecond*61235, &wg)
 }
 
 func TestConcurrent(t *testing.T) {
+  tw, clock := newFakeTimingWheel(60, time.Second)
+  defer tw.Stop()
   n := 10000
   var wg sync.WaitGroup
   wg.Add(n)
-  DefaultTimingWheel.Start()
+  var scheduled sync.WaitGroup
+  scheduled.Add(n)
   for i := 0; i < n; i++ {
-    t := time.Second * time.Duration(rand.Intn(100)+1)
-    DefaultTimingWheel.Delay(t, i, func(id uint64, data interface{}) {
-      fmt.Printf("executing task %d: %v\n", id, data)
-      wg.Done()
-    })
+    go func(i int) {
+      defer scheduled.Done()
+      d := time.Second * time.Duration(rand.Intn(100)+1)
+      tw.Delay(d, i, func(uint64, interface{}) {
+        wg.Done()
+      })
+    }(i)
   }
-  wg.Wait()
+  scheduled.Wait()
+  advanceUntil(t, clock, time.Second, time.Second*102, &wg)
 }
 
 func TestCustom(t *testing.T) {
-  tw := NewTimingWheel(100, time.Millisecond*100)
+  tw, clock := newFakeTimingWheel(100, time.Millisecond*100)
+  defer tw.Stop()
   n := 1000
   var wg sync.WaitGroup
   wg.Add(n)
-  tw.Start()
   for i := 0; i < n; i++ {
-    t := time.Millisecond * time.Duration(rand.Intn(1000)+1)
-    tw.Delay(t, i, func(id uint64, data interface{}) {
-      fmt.Printf("executing task %d: %v\n", id, data)
+    d := time.Millisecond * time.Duration(rand.Intn(1000)+1)
+    tw.Delay(d, i, expectAfter(t, clock, &wg, d))
+  }
+  advanceUntil(t, clock, time.Millisecond*100, time.Millisecond*1100, &wg)
+}
+
+func TestHierarchy(t *testing.T) {
+  if NewTimingWheel(1, time.Millisecond) != nil {
+    t.Error("expected nil for slots <= 1")
+  }
+  tw, clock := newFakeTimingWheel(4, time.Millisecond*10)
+  defer tw.Stop()
+  n := 200
+  var wg sync.WaitGroup
+  wg.Add(n)
+  for i := 0; i < n; i++ {
+    d := time.Millisecond * time.Duration(rand.Intn(2000)+1)
+    tw.Delay(d, i, expectAfter(t, clock, &wg, d))
+  }
+  advanceUntil(t, clock, time.Millisecond*10, time.Millisecond*2010, &wg)
+  if len(tw.levels) != 4 {
+    t.Errorf("levels: expected 4, got %d", len(tw.levels))
+  }
+}
+
+func TestCancel(t *testing.T) {
+  tw, clock := newFakeTimingWheel(4, time.Millisecond*10)
+  defer tw.Stop()
+  var wg sync.WaitGroup
+  wg.Add(1)
+  id := tw.Delay(time.Second, "cancelled", func(uint64, interface{}) {
+    t.Error("cancelled task fired")
+  })
+  tw.Delay(time.Second*2, "data", expectAfter(t, clock, &wg, time.Second*2))
+  clock.Advance(time.Millisecond * 500)
+  if !tw.Cancel(id) || tw.Cancel(id) {
+    t.Error("expected only the first Cancel to remove the task")
+  }
+  advanceUntil(t, clock, time.Millisecond*10, time.Millisecond*1520, &wg)
+}
+
+func TestID(t *testing.T) {
+  tw, clock := newFakeTimingWheel(4, time.Millisecond*10)
+  defer tw.Stop()
+  n := 100000
+  var wg sync.WaitGroup
+  wg.Add(n)
+  ids := make(map[uint64]struct{}, n)
+  for i := 0; i < n; i++ {
+    // 所有task都在同一个slot
+    id := tw.Delay(time.Millisecond*10, i, func(uint64, interface{}) {
+      wg.Done()
+    })
+    if _, ok := ids[id]; ok || id == 0 {
+      t.Fatalf("duplicate id %d", id)
+    }
+    ids[id] = struct{}{}
+  }
+  advanceUntil(t, clock, time.Millisecond*10, time.Millisecond*20, &wg)
+  for id := range ids {
+    if tw.Cancel(id) {
+      t.Fatalf("cancelled fired task %d", id)
+    }
+  }
+}
+
+func TestRepeat(t *testing.T) {
+  tw, clock := newFakeTimingWheel(10, time.Millisecond*10)
+  defer tw.Stop()
+  var wg sync.WaitGroup
+  wg.Add(5)
+  var mu sync.Mutex
+  ids := make(map[uint64]int)
+  tw.Repeat(time.Millisecond*20, &RepeatOption{MaxRuns: 5}, "rate", func(id uint64, data interface{}) {
+    mu.Lock()
+    ids[id]++
+    mu.Unlock()
+    wg.Done()
+  })
+  advanceUntil(t, clock, time.Millisecond*10, time.Millisecond*110, &wg)
+  clock.Advance(time.Millisecond * 100)
+  mu.Lock()
+  if len(ids) != 1 {
+    t.Errorf("expected stable id, got %v", ids)
+  }
+  for _, n := range ids {
+    if n != 5 {
+      t.Errorf("expected 5 runs, got %d", n)
+    }
+  }
+  mu.Unlock()
+
+  var n int
+  wg.Add(1)
+  var id uint64
+  mu.Lock()
+  id = tw.Repeat(time.Millisecond*20, &RepeatOption{Mode: FixedDelay}, "delay", func(uint64, interface{}) {
+    mu.Lock()
+    defer mu.Unlock()
+    n++
+    if n == 3 {
+      tw.Cancel(id)
       wg.Done()
+    }
+  })
+  mu.Unlock()
+  advanceWaitUntil(t, tw, clock, time.Millisecond*10, time.Second, &wg)
+  clock.Advance(time.Millisecond * 100)
+  mu.Lock()
+  if n != 3 {
+    t.Errorf("expected 3 runs after cancel, got %d", n)
+  }
+  mu.Unlock()
+}
+
+func TestFakeClock(t *testing.T) {
+  clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+  start := clock.Now()
+  ch1 := clock.After(time.Second * 2)
+  ch2 := clock.After(time.Second)
+  ticker := clock.NewTicker(time.Millisecond * 700)
+  ticks := make(chan time.Time, 16)
+  go func() {
+    for t := range ticker.C() {
+      ticks <- t
+    }
+  }()
+  clock.Advance(time.Millisecond * 1500)
+  select {
+  case <-ch1:
+    t.Error("After(2s) fired after 1.5s")
+  default:
+  }
+  if now := <-ch2; now.Sub(start) != time.Second {
+    t.Errorf("After(1s) fired at %v", now.Sub(start))
+  }
+  clock.Advance(time.Millisecond * 500)
+  if now := <-ch1; now.Sub(start) != time.Second*2 {
+    t.Errorf("After(2s) fired at %v", now.Sub(start))
+  }
+  ticker.Stop()
+  clock.Advance(time.Second)
+  for _, d := range []time.Duration{time.Millisecond * 700, time.Millisecond * 1400} {
+    if now := <-ticks; now.Sub(start) != d {
+      t.Errorf("expected tick at %v, got %v", d, now.Sub(start))
+    }
+  }
+  select {
+  case now := <-ticks:
+    t.Errorf("unexpected tick at %v", now.Sub(start))
+  default:
+  }
+}
+
+func TestWorkerPool(t *testing.T) {
+  var mu sync.Mutex
+  var panics []interface{}
+  pool := NewWorkerPool(2, 16, OverflowBlock, func(v interface{}) {
+    mu.Lock()
+    panics = append(panics, v)
+    mu.Unlock()
+  })
+  clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+  tw := NewTimingWheel(10, time.Millisecond*10, WithClock(clock), WithExecutor(pool))
+  tw.Start()
+  var wg sync.WaitGroup
+  wg.Add(100)
+  for i := 0; i < 100; i++ {
+    tw.Delay(time.Millisecond*time.Duration(rand.Intn(100)+1), i, func(id uint64, data interface{}) {
+      defer wg.Done()
+      if data.(int)%10 == 0 {
+        panic(data)
+      }
     })
   }
+  advanceUntil(t, clock, time.Millisecond*10, time.Millisecond*110, &wg)
+  tw.Stop()
+  pool.Close()
+  if len(panics) != 10 {
+    t.Errorf("expected 10 panics, got %d", len(panics))
+  }
+  if pool.Execute(func() {}) {
+    t.Error("closed pool accepted f")
+  }
+
+  block := make(chan struct{})
+  pool = NewWorkerPool(1, 1, OverflowDrop, nil)
+  started := make(chan struct{})
+  pool.Execute(func() {
+    close(started)
+    <-block
+  })
+  // 第一个f已经被worker取走，队列为空
+  <-started
+  if !pool.Execute(func() {}) || pool.Execute(func() {}) {
+    t.Error("expected second f to be dropped")
+  }
+  close(block)
+  pool.Close()
+
+  block = make(chan struct{})
+  pool = NewWorkerPool(1, 1, OverflowCallerRuns, nil)
+  started = make(chan struct{})
+  pool.Execute(func() {
+    close(started)
+    <-block
+  })
+  <-started
+  pool.Execute(func() {})
+  inline := false
+  pool.Execute(func() { inline = true })
+  if !inline {
+    t.Error("expected f to run in caller")
+  }
+  close(block)
+  pool.Wait()
+  pool.Close()
+}
+
+func TestDelayCtx(t *testing.T) {
+  tw, clock := newFakeTimingWheel(10, time.Millisecond*10)
+  h := tw.DelayCtx(nil, time.Millisecond*50, func(ctx context.Context) (interface{}, error) {
+    return "result", nil
+  })
+  clock.Advance(time.Millisecond * 100)
+  if v, e := h.Result(); v != "result" || e != nil {
+    t.Errorf("unexpected result: %v, %v", v, e)
+  }
+
+  h = tw.DelayCtx(nil, time.Millisecond*50, func(ctx context.Context) (interface{}, error) {
+    t.Error("cancelled task fired")
+    return nil, nil
+  })
+  if h.Err() != nil {
+    t.Error("expected nil error before done")
+  }
+  h.Cancel()
+  if _, e := h.Result(); e != context.Canceled {
+    t.Errorf("expected context.Canceled, got %v", e)
+  }
+
+  ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+  defer cancel()
+  h = tw.DelayCtx(ctx, time.Millisecond*50, func(ctx context.Context) (interface{}, error) {
+    t.Error("expired task fired")
+    return nil, nil
+  })
+  if _, e := h.Result(); e != context.DeadlineExceeded {
+    t.Errorf("expected context.DeadlineExceeded, got %v", e)
+  }
+
+  started := make(chan struct{})
+  running := tw.DelayCtx(nil, time.Millisecond*10, func(ctx context.Context) (interface{}, error) {
+    close(started)
+    <-ctx.Done()
+    return "aborted", ctx.Err()
+  })
+  pending := tw.DelayCtx(nil, time.Second, func(ctx context.Context) (interface{}, error) {
+    t.Error("task fired after stop")
+    return nil, nil
+  })
+  clock.Advance(time.Millisecond * 20)
+  <-started
+  tw.Stop()
+  if v, e := running.Result(); v != "aborted" || e != context.Canceled {
+    t.Errorf("unexpected result: %v, %v", v, e)
+  }
+  if _, e := pending.Result(); e != context.Canceled {
+    t.Errorf("expected context.Canceled, got %v", e)
+  }
+}
+
+func TestJournal(t *testing.T) {
+  dir, e := ioutil.TempDir("", "time2")
+  if e != nil {
+    t.Fatal(e)
+  }
+  defer os.RemoveAll(dir)
+  path := filepath.Join(dir, "tw.journal")
+  clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+  fired := make(chan interface{}, 16)
+  start := func(policy int) (*TimingWheel, *Journal) {
+    j, e := OpenJournal(path)
+    if e != nil {
+      t.Fatal(e)
+    }
+    tw := NewTimingWheel(10, time.Millisecond*100, WithClock(clock), WithJournal(j, policy))
+    tw.Register("retry", func(id uint64, data interface{}) {
+      fired <- data
+    })
+    tw.Start()
+    return tw, j
+  }
+
+  tw, j := start(MisfireFireNow)
+  tw.DelayDurable(time.Second, "retry", "data1")
+  tw.DelayDurable(time.Second*5, "retry", "data2")
+  tw.DelayDurable(time.Second*10, "retry", "data3")
+  id, _ := tw.DelayDurable(time.Second*10, "retry", "cancelled")
+  tw.Cancel(id)
+  if _, e := tw.DelayDurable(time.Second, "foo", nil); e == nil {
+    t.Error("expected error for unregistered handler")
+  }
+  clock.Advance(time.Millisecond * 1500)
+  if v := <-fired; v != "data1" {
+    t.Errorf("expected data1, got %v", v)
+  }
+  // 等待执行完后的删除记录写入
+  tw.StopAndWait()
+  if j.Len() != 2 {
+    t.Errorf("expected 2 records, got %d", j.Len())
+  }
+  j.Close()
+
+  // 重启时data2已经过期
+  clock.Advance(time.Second * 5)
+  tw, j = start(MisfireFireNow)
+  clock.Advance(time.Millisecond * 300)
+  if v := <-fired; v != "data2" {
+    t.Errorf("expected data2, got %v", v)
+  }
+  tw.StopAndWait()
+  if j.Len() != 1 {
+    t.Errorf("expected 1 record, got %d", j.Len())
+  }
+  if e := j.Compact(); e != nil {
+    t.Fatal(e)
+  }
+  j.Close()
+
+  // 重启时data3已经过期，丢弃
+  clock.Advance(time.Second * 5)
+  tw, j = start(MisfireSkip)
+  clock.Advance(time.Second)
+  select {
+  case v := <-fired:
+    t.Errorf("unexpected %v", v)
+  default:
+  }
+  if j.Len() != 0 {
+    t.Errorf("expected empty journal, got %d", j.Len())
+  }
+  tw.Stop()
+  j.Close()
+
+  // 末尾长度损坏的记录按不完整处理，不会按损坏的长度分配内存
+  j, _ = OpenJournal(path)
+  j.add(1, "retry", clock.Now(), "data4")
+  j.Close()
+  f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+  f.Write([]byte{0xff, 0xff, 0xff, 0xff, 1, 2, 3})
+  f.Close()
+  if j, e = OpenJournal(path); e != nil || j.Len() != 1 {
+    t.Fatalf("got %v", e)
+  }
+  j.Close()
+
+  // 暂停期间推迟的执行时间也写到日志中，写日志失败时通知Observer
+  o := &journalObserver{errs: make(chan error, 16)}
+  j, _ = OpenJournal(filepath.Join(dir, "tw2.journal"))
+  tw = NewTimingWheel(10, time.Millisecond*100, WithClock(clock), WithJournal(j, MisfireSkip), WithObserver(o))
+  tw.Register("retry", func(id uint64, data interface{}) {
+    fired <- data
+  })
+  tw.Start()
+  deadline := clock.Now().Add(time.Second * 6)
+  tw.DelayDurable(time.Second, "retry", "data5")
+  tw.Pause()
+  clock.Advance(time.Second * 5)
+  tw.Resume()
+  if recs := j.pending(); len(recs) != 1 || recs[0].Deadline != deadline.UnixNano() {
+    t.Errorf("journal deadline not shifted: %v", recs)
+  }
+  tw.Stop()
+  j.Close()
+  clock.Advance(time.Second)
+  tw.Start()
+  tw.Stop()
+  select {
+  case e := <-o.errs:
+    if e != os.ErrClosed {
+      t.Errorf("unexpected journal error %v", e)
+    }
+  default:
+    t.Error("journal error not reported")
+  }
+}
+
+type journalObserver struct {
+  countObserver
+
+  errs chan error
+}
+
+func (o *journalObserver) OnJournalError(id uint64, e error) {
+  o.errs <- e
+}
+
+func TestReset(t *testing.T) {
+  tw, clock := newFakeTimingWheel(10, time.Millisecond*100)
+  defer tw.Stop()
+  var wg sync.WaitGroup
+  wg.Add(1)
+  start := clock.Now()
+  id := tw.Delay(time.Second, "idle", func(id uint64, data interface{}) {
+    defer wg.Done()
+    if e := clock.Now().Sub(start); e < time.Millisecond*2500 {
+      t.Errorf("fired after %v", e)
+    }
+  })
+  id2 := tw.Delay(time.Second*10, "other", func(uint64, interface{}) {})
+  clock.Advance(time.Millisecond * 500)
+  if d, ok := tw.Remaining(id); !ok || d != time.Millisecond*500 {
+    t.Errorf("unexpected remaining: %v, %v", d, ok)
+  }
+  if !tw.Reset(id, time.Second) || !tw.Extend(id, time.Second) {
+    t.Error("reset failed")
+  }
+  if d, _ := tw.Remaining(id); d != time.Second*2 {
+    t.Errorf("expected 2s remaining, got %v", d)
+  }
+  pending := tw.Pending()
+  if len(pending) != 2 || pending[0].ID != id || pending[1].ID != id2 {
+    t.Errorf("unexpected pending: %+v", pending)
+  }
+  advanceUntil(t, clock, time.Millisecond*100, time.Millisecond*2200, &wg)
+  if tw.Exists(id) || !tw.Exists(id2) {
+    t.Error("unexpected Exists result")
+  }
+  if tw.Reset(id, time.Second) {
+    t.Error("reset fired task")
+  }
+
+  // 并发的Extend不会丢失
+  before, _ := tw.Remaining(id2)
+  var ewg sync.WaitGroup
+  for i := 0; i < 10; i++ {
+    ewg.Add(1)
+    go func() {
+      defer ewg.Done()
+      tw.Extend(id2, time.Second)
+    }()
+  }
+  ewg.Wait()
+  if d, _ := tw.Remaining(id2); d != before+time.Second*10 {
+    t.Errorf("expected %v remaining, got %v", before+time.Second*10, d)
+  }
+}
+
+func TestLifecycle(t *testing.T) {
+  tw, clock := newFakeTimingWheel(10, time.Millisecond*100)
+  fired := make(chan interface{}, 16)
+  f := func(id uint64, data interface{}) {
+    fired <- data
+  }
+  tw.Delay(time.Millisecond*500, "data1", f)
+  tw.Pause()
+  clock.Advance(time.Second)
+  tw.Resume()
+  select {
+  case v := <-fired:
+    t.Errorf("%v fired while paused", v)
+  default:
+  }
+  clock.Advance(time.Millisecond * 600)
+  if v := <-fired; v != "data1" {
+    t.Errorf("expected data1, got %v", v)
+  }
+
+  tw.Delay(time.Millisecond*500, "data2", f)
+  tw.StopAndWait()
+  clock.Advance(time.Second)
+  tw.Start()
+  clock.Advance(time.Millisecond * 600)
+  if v := <-fired; v != "data2" {
+    t.Errorf("expected data2, got %v", v)
+  }
+
+  tw.Delay(time.Millisecond*150, "due", f)
+  tw.Delay(time.Second, "unfired", f)
+  clock.Advance(time.Millisecond * 160)
+  unfired, e := tw.Shutdown(context.Background())
+  if e != nil || len(unfired) != 1 || unfired[0].Data != "unfired" {
+    t.Errorf("unexpected result: %+v, %v", unfired, e)
+  }
+  if v := <-fired; v != "due" {
+    t.Errorf("expected due, got %v", v)
+  }
+  if len(tw.Pending()) != 0 {
+    t.Error("expected empty wheel after shutdown")
+  }
+}
+
+// 普通模式下暂停期间deadline也不走，Remaining/Extend/Shutdown按暂停前的进度计算
+func TestPauseDeadline(t *testing.T) {
+  tw, clock := newFakeTimingWheel(10, time.Millisecond*100)
+  fired := make(chan interface{}, 16)
+  id := tw.Delay(time.Second, "data", func(id uint64, data interface{}) {
+    fired <- data
+  })
+  clock.Advance(time.Millisecond * 400)
+  tw.Pause()
+  clock.Advance(time.Second * 5)
+  if d, ok := tw.Remaining(id); !ok || d != time.Millisecond*600 {
+    t.Errorf("expected 600ms remaining while paused, got %v, %v", d, ok)
+  }
+  if !tw.Extend(id, time.Millisecond*200) {
+    t.Error("extend failed")
+  }
+  select {
+  case v := <-fired:
+    t.Errorf("%v fired after extend while paused", v)
+  default:
+  }
+  tw.Resume()
+  if d, _ := tw.Remaining(id); d != time.Millisecond*800 {
+    t.Errorf("expected 800ms remaining after resume, got %v", d)
+  }
+  clock.Advance(time.Millisecond * 300)
+  tw.Stop()
+  clock.Advance(time.Second * 5)
+  unfired, e := tw.Shutdown(context.Background())
+  if e != nil || len(unfired) != 1 || unfired[0].ID != id {
+    t.Errorf("unexpected result: %+v, %v", unfired, e)
+  }
+  select {
+  case v := <-fired:
+    t.Errorf("%v fired by shutdown", v)
+  default:
+  }
+}
+
+type countObserver struct {
+  scheduled, fired, cancelled int
+
+  mu sync.Mutex
+}
+
+func (o *countObserver) OnSchedule(id uint64, deadline time.Time) {
+  o.mu.Lock()
+  o.scheduled++
+  o.mu.Unlock()
+}
+
+func (o *countObserver) OnFire(id uint64, lag time.Duration) {
+  o.mu.Lock()
+  o.fired++
+  o.mu.Unlock()
+}
+
+func (o *countObserver) OnCancel(id uint64) {
+  o.mu.Lock()
+  o.cancelled++
+  o.mu.Unlock()
+}
+
+func (o *countObserver) OnTick(d time.Duration, expired int) {}
+
+func TestStats(t *testing.T) {
+  o := &countObserver{}
+  clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+  tw := NewTimingWheel(10, time.Millisecond*100, WithClock(clock), WithObserver(o))
+  tw.Start()
+  defer tw.Stop()
+  wg := &sync.WaitGroup{}
+  wg.Add(2)
+  f := func(id uint64, data interface{}) {
+    wg.Done()
+  }
+  tw.Delay(time.Millisecond*300, nil, f)
+  tw.Delay(time.Millisecond*500, nil, f)
+  tw.Cancel(tw.Delay(time.Second, nil, f))
+  tw.Delay(time.Second*5, nil, f)
+  clock.Advance(time.Millisecond * 600)
   wg.Wait()
+  tw.executor.Wait()
+
+  s := tw.Stats()
+  if s.Scheduled != 4 || s.Fired != 2 || s.Cancelled != 1 || s.Pending != 1 || s.Ticks != 6 {
+    t.Errorf("unexpected stats: %+v", s)
+  }
+  if s.FireLag.Count != 2 || len(s.FireLag.Counts) != len(s.FireLag.Bounds)+1 {
+    t.Errorf("unexpected fire lag: %+v", s.FireLag)
+  }
+  if len(s.SlotPending) != 2 || s.SlotPending[1][5] != 1 {
+    t.Errorf("unexpected slot pending: %v", s.SlotPending)
+  }
+  o.mu.Lock()
+  if o.scheduled != 4 || o.fired != 2 || o.cancelled != 1 {
+    t.Errorf("unexpected observer counts: %+v", o)
+  }
+  o.mu.Unlock()
+
+  buf := &bytes.Buffer{}
+  if e := tw.WritePrometheus(buf, "tw"); e != nil {
+    t.Fatal(e)
+  }
+  for _, line := range []string{"tw_fired_total 2\n", "tw_pending 1\n", "tw_slot_pending{level=\"1\",slot=\"5\"} 1\n", "tw_fire_lag_seconds_count 2\n"} {
+    if !strings.Contains(buf.String(), line) {
+      t.Errorf("missing %q in:\n%s", line, buf.String())
+    }
+  }
+}
+
+func TestPrecision(t *testing.T) {
+  clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+  tw := NewTimingWheel(10, time.Millisecond*100, WithClock(clock), WithPrecision(time.Millisecond))
+  tw.Start()
+  defer tw.Stop()
+  advanceTo := func(target time.Time) {
+    for clock.Now().Before(target) {
+      clock.Advance(time.Millisecond)
+    }
+  }
+  // 推进到deadline后时钟停住，task必须在不再推进的情况下执行，
+  // 默认模式下至少要多等一个slot（100ms），会超时
+  waitFired := func(fired chan time.Time, deadline time.Time) {
+    select {
+    case v := <-fired:
+      if v.Before(deadline.Add(-time.Millisecond)) {
+        t.Errorf("deadline %v, fired at %v", deadline, v)
+      }
+    case <-time.After(time.Second * 5):
+      t.Fatalf("not fired at %v", deadline)
+    }
+  }
+  fired := make(chan time.Time, 1)
+  f := func(id uint64, data interface{}) {
+    fired <- clock.Now()
+  }
+  start := clock.Now()
+  delays := []time.Duration{time.Millisecond * 30, time.Millisecond * 150, time.Millisecond * 420, time.Millisecond * 1250}
+  for _, d := range delays {
+    tw.Delay(d, nil, f)
+  }
+  id := tw.Delay(time.Millisecond*120, nil, func(id uint64, data interface{}) {
+    t.Error("cancelled task fired")
+  })
+  for i, d := range delays {
+    if i == 1 {
+      advanceTo(start.Add(time.Millisecond * 110))
+      if !tw.Cancel(id) {
+        t.Error("cancel failed")
+      }
+    }
+    advanceTo(start.Add(d))
+    waitFired(fired, start.Add(d))
+  }
+
+  // 暂停的时间不计入
+  start = clock.Now()
+  tw.Delay(time.Millisecond*250, nil, f)
+  advanceTo(start.Add(time.Millisecond * 50))
+  tw.Pause()
+  advanceTo(start.Add(time.Millisecond * 250))
+  tw.Resume()
+  advanceTo(start.Add(time.Millisecond * 450))
+  waitFired(fired, start.Add(time.Millisecond*450))
 }